@@ -19,18 +19,17 @@ func main() {
 	config.Init()
 	botInstance, messageQueue := bot.Init()
 
-	var inferenceProvider llm.Client
-	switch config.Data.Provider {
-	case config.OpenAI:
-		inferenceProvider = llm.NewOpenAIClient(config.Data.OpenAI.Endpoint, config.Data.OpenAI.ApiKey)
-	default:
-		zap.L().Panic("unknown LLM inference provider", zap.Any("provider", config.Data.Provider))
+	inferenceProvider, err := llm.NewRegistryFromConfig()
+	if err != nil {
+		zap.L().Panic("invalid provider config", zap.Error(err))
 	}
+	inferenceProvider.StartProbes(appCtx)
+	client := bot.WithResponseCache(inferenceProvider)
 
 	for {
 		select {
 		case discordMessage := <-messageQueue:
-			go bot.HandleMessage(discordMessage.Message, discordMessage.Session, inferenceProvider, appCtx)
+			go bot.HandleMessage(discordMessage.Message, discordMessage.Session, client, appCtx)
 		case <-appCtx.Done():
 			_ = botInstance.Close()
 			bot.Close() // Close database connection
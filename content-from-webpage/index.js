@@ -28,11 +28,21 @@ const CUSTOM_STRATEGY = {
         return iframe.evaluate(() => document.querySelector('.tgme_widget_message_text').textContent)
     },
 
-    // PDF
+    // PDF, downloaded by the browser so it goes through the same proxy as the page
     'application/pdf': async (webpage) => {
         setTimeout(() => process.exit(4), ONLOAD_TIMEOUT_MS)
 
-        return readPdfText({ url: await webpage.evaluate(() => window.location.href) })
+        const data = await webpage.evaluate(async () => {
+            const response = await fetch(window.location.href)
+            const bytes = new Uint8Array(await response.arrayBuffer())
+
+            let binary = ''
+            for (const byte of bytes) binary += String.fromCharCode(byte)
+
+            return btoa(binary)
+        })
+
+        return readPdfText({ data: new Uint8Array(Buffer.from(data, 'base64')) })
     },
 }
 
@@ -50,7 +60,9 @@ class WebpageContentParser {
     }
 
     async init() {
-        const browser = await puppeteer.launch({ headless: true, defaultViewport: { width: 1700, height: 800 } })
+        // Everything, loopback included, goes through FETCH_PROXY, which only connects to public addresses
+        const args = process.env.FETCH_PROXY ? [`--proxy-server=${process.env.FETCH_PROXY}`, '--proxy-bypass-list=<-loopback>'] : []
+        const browser = await puppeteer.launch({ headless: true, defaultViewport: { width: 1700, height: 800 }, args })
         this.webpage = await browser.newPage()
 
         await this.webpage.setUserAgent('Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/66.0.3359.181 Safari/537.36')
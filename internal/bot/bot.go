@@ -6,11 +6,11 @@ import (
 	"discord-military-analyst-bot/internal/db"
 	"discord-military-analyst-bot/internal/llm"
 	"errors"
-	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -20,11 +20,19 @@ import (
 
 var messageDB *db.MessageDB
 
+// tools are the actions offered to the model when tool calling is enabled
+var tools []llm.Tool
+
 type DiscordMessage struct {
 	Session *discordgo.Session
 	Message *discordgo.MessageCreate
 }
 
+// RegisterTool makes a tool available to the model
+func RegisterTool(tool llm.Tool) {
+	tools = append(tools, tool)
+}
+
 // Close closes the database connection
 func Close() {
 	if messageDB != nil {
@@ -46,6 +54,20 @@ func Init() (*discordgo.Session, chan *DiscordMessage) {
 		return nil, nil
 	}
 
+	embedder, err = llm.NewEmbedderFromConfig()
+	if err != nil {
+		zap.L().Panic("failed to initialize embeddings", zap.Error(err))
+		return nil, nil
+	}
+
+	transcriber = llm.NewTranscriberFromConfig()
+	synthesizer = llm.NewSynthesizerFromConfig()
+	imageGenerator = llm.NewImageGeneratorFromConfig()
+
+	if config.Data.Tools.Enabled {
+		RegisterTool(NewFetchURLTool(config.Data.Tools.FetchURLMaxTokens))
+	}
+
 	discord, err := discordgo.New("Bot " + config.Data.Discord.Token)
 	queue := make(chan *DiscordMessage, 128)
 
@@ -150,9 +172,11 @@ func FetchHistory(message *discordgo.MessageCreate, session *discordgo.Session,
 		}
 
 		history = append(history, llm.HistoryItem{
+			ID:           current.ID,
 			IsBotMessage: current.Author.ID == botId,
 			Content:      current.Content,
 			Attachments:  current.Attachments,
+			CreatedAt:    current.Timestamp,
 		})
 
 		if current.Type == discordgo.MessageTypeReply {
@@ -182,6 +206,8 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 		if err != nil {
 			zap.L().Error("failed to save message to database", zap.Error(err))
 		}
+
+		go indexMessage(msg.Message)
 	}
 
 	err, history := FetchHistory(msg, session, config.Data.Discord.BotId)
@@ -191,6 +217,16 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 
 	zap.L().Debug("message received", zap.String("text", msg.Content))
 
+	conversationID := msg.ID
+	if messageDB != nil {
+		conversationID = messageDB.GetConversationRoot(msg.ID)
+	}
+	ctx = withConversation(ctx, conversationID)
+	ctx, responseInfo := llm.WithResponseInfo(ctx)
+	if cacheDisabled(msg.ChannelID) {
+		ctx = llm.WithoutCache(ctx)
+	}
+
 	ignoreSystemPrompt := false
 	if config.Data.Discord.IgnoreSystemKeyword != "" {
 		if strings.Contains(msg.Content, config.Data.Discord.IgnoreSystemKeyword) {
@@ -225,16 +261,54 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 		zap.L().Panic("error reading prompt file", zap.Error(err))
 	}
 
+	exceeded := exceededQuota(msg)
+	if exceeded != nil && config.Data.Quota.DowngradeModel == "" {
+		_, _ = sendOrEdit(session, msg, nil, exceeded.reply)
+		return
+	}
+
 	if config.Data.Discord.Typing {
 		_ = session.ChannelTyping(msg.ChannelID)
 	}
 
 	llmRequest := ""
+	pageContent := ""
+	pageSuspicious := false
+	requestKind := "chat"
 	msgContent := msg.Content
 	if ignoreSystemPrompt {
 		msgContent = strings.ReplaceAll(msg.Content, config.Data.Discord.IgnoreSystemKeyword, "")
 	}
 
+	speak := wantsSpeech(msg)
+	if config.Data.Discord.SpeakKeyword != "" {
+		msgContent = strings.ReplaceAll(msgContent, config.Data.Discord.SpeakKeyword, "")
+	}
+
+	// Voice messages have no content of their own
+	if transcript := transcribeAttachments(ctx, msg.ID, msg.Attachments); transcript != "" {
+		msgContent = strings.TrimSpace(msgContent + "\n" + transcript)
+	}
+
+	moderator := llm.NewModeratorFromConfig(client)
+	requestAction := moderate(ctx, session, msg, moderator, "request", msgContent)
+	holdResponse := moderator != nil && withholdsResponses(moderationPolicy(msg.GuildID))
+	if requestAction == "refuse" {
+		_, _ = sendOrEdit(session, msg, nil, refusedRequestReply)
+		return
+	}
+
+	if wantsImage(msg) {
+		// Images can't be downgraded to a cheaper model
+		if exceeded != nil {
+			_, _ = sendOrEdit(session, msg, nil, exceeded.reply)
+			return
+		}
+
+		handleImage(ctx, msg, session, client, responseInfo)
+		return
+	}
+
 	if len(history) <= 1 && url != "" {
 		zap.L().Info("found url to parse", zap.String("url", url))
 
@@ -245,21 +319,33 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 			})
 		}
 
+		if link := earlierSummary(msg, url); link != "" {
+			zap.L().Info("linking earlier summary", zap.String("url", url), zap.String("summary", link))
+			_, _ = sendOrEdit(session, msg, nil, "Already summarized: "+link)
+			return
+		}
+
 		_ = session.MessageReactionAdd(msg.ChannelID, msg.ID, "👀")
-		err, parsedContent := ParseURL(url)
+		err, parsedContent, suspicious := fetchPage(ctx, url)
 		if err != nil {
 			_, _ = session.ChannelMessageSendReply(msg.ChannelID, "Your link is bullshit bro.", msg.MessageReference)
 			return
 		}
 
 		zap.L().Debug("content parser success")
-		content := fmt.Sprintf("URL: %s\nContent:\n%s", url, parsedContent)
-		llmRequest = content
+		pageContent = parsedContent
+		pageSuspicious = suspicious
+		requestKind = "url"
 	} else {
 		zap.L().Info("no url found", zap.String("message", msgContent))
 		llmRequest = msgContent
 	}
 
+	// Pages reach the model either with the request or through the fetch_url tool
+	if requestKind == "url" || (config.Data.Tools.Enabled && len(tools) > 0) {
+		system += "\n\n" + pageInstruction
+	}
+
 	// Get message history
 	var allHistory []llm.HistoryItem
 	if ignoreSystemPrompt {
@@ -271,7 +357,11 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 		}
 	} else {
 		// Get full history for normal mode
-		if messageDB != nil {
+		if embedder != nil {
+			// The past messages most related to the prompt, instead of the latest chatter, go before the reply chain
+			// so the model doesn't take them for the latest turns
+			allHistory = slices.Concat(relatedMessages(ctx, msg, msgContent, history), history)
+		} else if messageDB != nil {
 			allHistory, err = messageDB.GetAllRelatedMessages(msg.ID, config.Data.Discord.BotId)
 			if err != nil {
 				zap.L().Error("failed to get all related messages", zap.Error(err))
@@ -282,100 +372,161 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 		}
 	}
 
-	zap.L().Debug("inferencing with streaming", zap.String("content", llmRequest), zap.Any("history", allHistory))
+	if config.Data.Vision.Enabled {
+		allHistory = withAttachments(allHistory, msg.ReferencedMessage, msg.Message)
+	}
+	allHistory = withTranscripts(ctx, allHistory)
 
-	var sentMessage *discordgo.Message
-	var messageCreated bool
+	var roles []string
+	if msg.Member != nil {
+		roles = msg.Member.Roles
+	}
 
-	// Use streaming API
-	openaiClient, ok := client.(*llm.OpenAIClient)
-	if !ok {
-		zap.L().Error("client is not an OpenAIClient, falling back to non-streaming")
-		llmResponse, inferErr := client.Infer(ctx, config.Data.Model, system, llmRequest, allHistory)
-		if inferErr != nil {
-			zap.L().Error("error while trying to infer an llm", zap.Error(inferErr))
-			return
-		}
+	model := routeModel(routeRequest{
+		Kind:      requestKind,
+		Images:    hasImages(allHistory),
+		Tokens:    contextBudget(config.Data.Model).Estimate(system, llmRequest, pageContent, allHistory),
+		ChannelID: msg.ChannelID,
+		Roles:     roles,
+	})
 
-		if len(llmResponse) > 1999 {
-			llmResponse = llmResponse[:1999]
-		}
+	if exceeded != nil {
+		zap.L().Info("quota exceeded, downgrading", zap.String("quota", exceeded.name), zap.String("model", config.Data.Quota.DowngradeModel))
+		model = config.Data.Quota.DowngradeModel
+	}
 
-		if llmResponse == "" {
-			zap.L().Warn("empty llm response")
-			return
-		}
+	capabilities := llm.CapabilitiesOf(client, model)
+	if !capabilities.Vision {
+		allHistory = withoutAttachments(allHistory)
+	}
 
-		// Update the message with the full response
-		_, err = session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, llmResponse)
-		if err != nil {
-			zap.L().Error("error updating message", zap.Error(err))
-		}
+	// Fit the page and the history into the model's context window, the page block is the whole request and carries
+	// the URL even if none of the content fits
+	resolvedModel := resolveModel(client, model)
+	pageContent, allHistory = fitContext(resolvedModel, system, llmRequest, pageContent, allHistory)
+	if requestKind == "url" {
+		llmRequest = pageBlock(url, pageContent, pageSuspicious)
+	}
 
-		return
+	request := llm.Request{
+		Model:   model,
+		System:  system,
+		Message: llmRequest,
+		History: allHistory,
+		User:    msg.Author.ID,
 	}
 
-	// Use streaming for OpenAI client
+	zap.L().Debug("inferencing", zap.String("content", llmRequest), zap.Any("history", allHistory), zap.Any("capabilities", capabilities))
+
+	var sentMessage *discordgo.Message
+	var messageCreated bool
+
+	// Streamed content is sent as it comes and edited in place, a complete response is sent as a fresh reply
 	var fullResponse strings.Builder
 	var lastUpdateTime time.Time
 	updateInterval := 500 * time.Millisecond // Update message every 500ms
 
-	_, streamErr := openaiClient.InferWithStream(ctx, config.Data.Model, system, llmRequest, allHistory,
-		func(content string, done bool) {
-			fullResponse.WriteString(content)
-			currentTime := time.Now()
-
-			// Create initial message when we receive the first content
-			if !messageCreated && content != "" {
-				var initialErr error
-				if msg.GuildID == "" {
-					sentMessage, initialErr = session.ChannelMessageSend(msg.ChannelID, content)
-				} else {
-					sentMessage, initialErr = session.ChannelMessageSendReply(msg.ChannelID, content, msg.Reference())
-				}
+	streamCallback := func(content string, done bool) {
+		fullResponse.WriteString(content)
+		currentTime := time.Now()
 
-				if initialErr != nil {
-					zap.L().Error("error sending initial message", zap.Error(initialErr))
-					return
-				}
+		// A response the guild's policy may withhold is only sent once the check passed
+		if holdResponse {
+			return
+		}
 
-				// Save the initial bot response to the database
-				if messageDB != nil && sentMessage != nil {
-					err := messageDB.SaveMessage(sentMessage, true)
-					if err != nil {
-						zap.L().Error("failed to save initial bot response to database", zap.Error(err))
-					}
+		// Create initial message when we receive the first content
+		if !messageCreated && content != "" {
+			// Replaces the thinking status if there is one
+			var initialErr error
+			sentMessage, initialErr = sendOrEdit(session, msg, sentMessage, content)
+
+			if initialErr != nil {
+				zap.L().Error("error sending initial message", zap.Error(initialErr))
+				return
+			}
+
+			// Save the initial bot response to the database
+			if messageDB != nil && sentMessage != nil {
+				err := messageDB.SaveMessage(sentMessage, true)
+				if err != nil {
+					zap.L().Error("failed to save initial bot response to database", zap.Error(err))
 				}
+			}
+
+			messageCreated = true
+			lastUpdateTime = currentTime
+			return
+		}
+
+		// Update the message if enough time has passed or if it's the final update
+		if messageCreated && (done || currentTime.Sub(lastUpdateTime) >= updateInterval) {
+			responseText := fullResponse.String()
 
-				messageCreated = true
+			// Truncate if needed
+			if len(responseText) > 1999 {
+				responseText = responseText[:1999]
+			}
+
+			// Only update if there's content
+			if responseText != "" {
+				_, err := session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, responseText)
+				if err != nil {
+					zap.L().Error("error updating message", zap.Error(err))
+				}
 				lastUpdateTime = currentTime
+			}
+		}
+	}
+
+	if config.Data.Reasoning.Display != "hidden" {
+		responseInfo.OnReasoning = func(chunk string) {
+			if messageCreated || time.Since(lastUpdateTime) < updateInterval {
 				return
 			}
 
-			// Update the message if enough time has passed or if it's the final update
-			if messageCreated && (done || currentTime.Sub(lastUpdateTime) >= updateInterval) {
-				responseText := fullResponse.String()
+			// The reasoning isn't moderated, so only the status is shown
+			reasoning := responseInfo.Reasoning
+			if holdResponse {
+				reasoning = ""
+			}
 
-				// Truncate if needed
-				if len(responseText) > 1999 {
-					responseText = responseText[:1999]
-				}
+			statusMessage, statusErr := sendOrEdit(session, msg, sentMessage, thinkingStatus(reasoning))
+			if statusErr != nil {
+				zap.L().Error("error updating thinking status", zap.Error(statusErr))
+				return
+			}
 
-				// Only update if there's content
-				if responseText != "" {
-					_, err := session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, responseText)
-					if err != nil {
-						zap.L().Error("error updating message", zap.Error(err))
-					}
-					lastUpdateTime = currentTime
-				}
+			sentMessage = statusMessage
+			lastUpdateTime = time.Now()
+		}
+	}
+
+	var streamErr error
+	toolClient, supportsTools := client.(llm.ToolClient)
+	streamClient, supportsStreaming := client.(llm.StreamClient)
+	switch {
+	case capabilities.Tools && supportsTools && config.Data.Tools.Enabled && len(tools) > 0:
+		// The tools run first, only the final answer is sent
+		var response string
+		response, streamErr = llm.RunTools(ctx, toolClient, request, tools, config.Data.Tools.MaxSteps, func([]llm.ToolCall) {
+			if config.Data.Discord.Typing {
+				_ = session.ChannelTyping(msg.ChannelID)
 			}
 		})
+		fullResponse.WriteString(response)
+	case capabilities.Streaming && supportsStreaming:
+		_, streamErr = streamClient.InferWithStream(ctx, request, streamCallback)
+	default:
+		var response string
+		response, streamErr = client.Infer(ctx, request)
+		fullResponse.WriteString(response)
+	}
 
 	if streamErr != nil {
-		zap.L().Error("error while streaming from llm", zap.Error(streamErr))
+		zap.L().Error("error while inferencing", zap.Error(streamErr))
 		// Try to update the message with the error
-		_, _ = session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, "Error generating response")
+		_, _ = sendOrEdit(session, msg, sentMessage, errorReply(streamErr))
 		return
 	}
 
@@ -387,29 +538,238 @@ func HandleMessage(msg *discordgo.MessageCreate, session *discordgo.Session, cli
 
 	if finalResponse == "" {
 		zap.L().Warn("empty llm response")
-		_, _ = session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, "No response generated")
+		_, _ = sendOrEdit(session, msg, sentMessage, "No response generated")
 		return
 	}
 
-	// Update the message with the final response
-	updatedMessage, editErr := session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, finalResponse)
+	// Nothing of the response was sent yet if the policy may withhold it, so refused text is never shown
+	responseAction := moreSevere(requestAction, moderate(ctx, session, msg, moderator, "response", fullResponse.String()))
+	switch responseAction {
+	case "refuse":
+		finalResponse = refusedResponseReply
+		speak = false
+	case "spoiler":
+		finalResponse = spoilered(fullResponse.String())
+		speak = false
+	}
+
+	// Update the message with the final response, or send it if nothing was streamed
+	updatedMessage, editErr := sendOrEdit(session, msg, sentMessage, finalResponse)
 	if editErr != nil {
 		zap.L().Error("error updating final message", zap.Error(editErr))
 		return
 	}
 
+	if speak {
+		updatedMessage = attachSpeech(ctx, session, updatedMessage, fullResponse.String(), speechVoice(ignoreSystemPrompt))
+	}
+
+	servedBy := responseInfo.ServedBy
+	if servedBy == "" {
+		servedBy = model
+	}
+	if updatedMessage == nil {
+		return
+	}
+	zap.L().Debug("reply sent", zap.String("messageId", updatedMessage.ID), zap.String("servedBy", servedBy))
+
 	// Update the saved message in the database
-	if messageDB != nil && updatedMessage != nil {
+	if messageDB != nil {
 		err := messageDB.SaveMessage(updatedMessage, true)
 		if err != nil {
 			zap.L().Error("failed to save updated bot response to database", zap.Error(err))
 		}
+
+		err = messageDB.SetServedBy(updatedMessage.ID, servedBy)
+		if err != nil {
+			zap.L().Error("failed to record which target served the response", zap.Error(err))
+		}
+
+		if responseInfo.Reasoning != "" {
+			err = messageDB.SetReasoning(updatedMessage.ID, responseInfo.Reasoning)
+			if err != nil {
+				zap.L().Error("failed to save reasoning", zap.Error(err))
+			}
+		}
+
+		if !responseInfo.Cached {
+			promptEstimate := contextBudget(resolvedModel).Estimate(system, llmRequest, "", allHistory)
+			saveUsage(msg, updatedMessage.ID, responseInfo, resolvedModel, promptEstimate, fullResponse.String())
+		}
+
+		// A withheld summary shouldn't be linked to when the page comes up again
+		if requestKind == "url" && responseAction != "refuse" && responseAction != "spoiler" {
+			saveSummary(msg, url, updatedMessage)
+		}
+
+		go indexMessage(updatedMessage)
+	}
+}
+
+// withAttachments appends the image attachments of the given messages to the history unless they are already in it,
+// so the referenced and current message's images reach the model even if the history source dropped them
+func withAttachments(history []llm.HistoryItem, messages ...*discordgo.Message) []llm.HistoryItem {
+	seen := make(map[string]bool)
+	for _, item := range history {
+		for _, attachment := range item.Attachments {
+			seen[attachment.ID] = true
+		}
+	}
+
+	for _, message := range messages {
+		if message == nil {
+			continue
+		}
+
+		var attachments []*discordgo.MessageAttachment
+		for _, attachment := range message.Attachments {
+			if llm.IsImageAttachment(attachment) && !seen[attachment.ID] {
+				attachments = append(attachments, attachment)
+				seen[attachment.ID] = true
+			}
+		}
+
+		if len(attachments) > 0 {
+			history = append(history, llm.HistoryItem{
+				ID:           message.ID,
+				IsBotMessage: message.Author != nil && message.Author.ID == config.Data.Discord.BotId,
+				Attachments:  attachments,
+				CreatedAt:    message.Timestamp,
+			})
+		}
+	}
+
+	return history
+}
+
+// withoutAttachments drops the attachments from the history for models that can't see them, so they don't take up
+// the context budget
+func withoutAttachments(history []llm.HistoryItem) []llm.HistoryItem {
+	stripped := make([]llm.HistoryItem, 0, len(history))
+	for _, item := range history {
+		if item.Content == "" && len(item.ToolCalls) == 0 {
+			continue
+		}
+
+		item.Attachments = nil
+		stripped = append(stripped, item)
 	}
+
+	return stripped
+}
+
+// resolveModel returns the actual model name behind an alias if the client, or a client it wraps, routes by alias
+func resolveModel(client llm.Client, model string) string {
+	for {
+		switch c := client.(type) {
+		case *llm.Registry:
+			_, _, resolved := c.Resolve(model)
+			return resolved
+		case interface{ Unwrap() llm.Client }:
+			client = c.Unwrap()
+		default:
+			return model
+		}
+	}
+}
+
+// contextBudget returns the context budget configured for the model
+func contextBudget(model string) llm.ContextBudget {
+	budget := llm.ContextBudget{
+		Window:          config.Data.Context.Window,
+		ResponseReserve: config.Data.Context.ResponseReserve,
+		Estimator:       llm.TokenEstimator{CharsPerToken: config.Data.Context.CharsPerToken},
+		Vision:          config.Data.Vision,
+	}
+
+	if modelContext, ok := config.Data.Context.Models[model]; ok {
+		if modelContext.Window > 0 {
+			budget.Window = modelContext.Window
+		}
+		if modelContext.CharsPerToken > 0 {
+			budget.Estimator.CharsPerToken = modelContext.CharsPerToken
+		}
+	}
+
+	return budget
+}
+
+// fitContext trims the page content and the history to the model's context budget and logs what was dropped
+func fitContext(model string, system string, request string, page string, history []llm.HistoryItem) (string, []llm.HistoryItem) {
+	page, history, report := contextBudget(model).Fit(system, request, page, history)
+	if report.DroppedHistoryItems > 0 || report.TruncatedTokens > 0 {
+		zap.L().Info("context trimmed to fit the model",
+			zap.String("model", model),
+			zap.Int("usedTokens", report.UsedTokens),
+			zap.Int("droppedHistoryItems", report.DroppedHistoryItems),
+			zap.Int("droppedHistoryTokens", report.DroppedTokens),
+			zap.Int("truncatedPageTokens", report.TruncatedTokens),
+		)
+	}
+
+	return page, history
+}
+
+// thinkingStatus is shown while a reasoning model thinks, with the end of the reasoning under a spoiler if configured
+func thinkingStatus(reasoning string) string {
+	status := "-# thinking…"
+	if config.Data.Reasoning.Display != "spoiler" {
+		return status
+	}
+
+	reasoning = strings.TrimSpace(strings.ReplaceAll(reasoning, "||", "| |"))
+	if runes := []rune(reasoning); len(runes) > 1500 {
+		reasoning = "…" + string(runes[len(runes)-1500:])
+	}
+
+	if reasoning == "" {
+		return status
+	}
+
+	return status + "\n||" + reasoning + "||"
+}
+
+// errorReply turns an inference error into a message for the user
+func errorReply(err error) string {
+	var blockedErr *llm.BlockedError
+	switch {
+	case errors.As(err, &blockedErr):
+		zap.L().Warn("llm response blocked", zap.String("reason", blockedErr.Reason), zap.Bool("prompt", blockedErr.Prompt))
+		return "Blocked by the provider's content filter (" + blockedErr.Reason + ")"
+	case errors.Is(err, llm.ErrRateLimited):
+		return "Too many requests right now, try again in a minute"
+	case errors.Is(err, llm.ErrContextLength):
+		return "This conversation is too long for the model, start a new one"
+	case errors.Is(err, llm.ErrServer):
+		return "The inference server is having a bad day, try again later"
+	default:
+		return "Error generating response"
+	}
+}
+
+// sendOrEdit replaces the text of the streamed reply, or sends a new reply if nothing was streamed yet
+func sendOrEdit(session *discordgo.Session, msg *discordgo.MessageCreate, sentMessage *discordgo.Message, text string) (*discordgo.Message, error) {
+	if sentMessage != nil {
+		return session.ChannelMessageEdit(sentMessage.ChannelID, sentMessage.ID, text)
+	}
+
+	if msg.GuildID == "" {
+		return session.ChannelMessageSend(msg.ChannelID, text)
+	}
+
+	return session.ChannelMessageSendReply(msg.ChannelID, text, msg.Reference())
 }
 
 func ParseURL(url string) (error, string) {
+	proxyURL, err := startFetchProxy()
+	if err != nil {
+		zap.L().Error("failed to start the fetch proxy", zap.Error(err))
+		return err, ""
+	}
+
 	cmd := exec.Command("node", "index.js", url)
 	cmd.Dir = filepath.Join(".", "content-from-webpage")
+	cmd.Env = append(os.Environ(), "FETCH_PROXY="+proxyURL)
 
 	output, err := cmd.Output()
 	if err != nil {
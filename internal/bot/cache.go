@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/db"
+	"discord-military-analyst-bot/internal/llm"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// WithResponseCache wraps the client with the SQLite response cache if it is enabled
+func WithResponseCache(client llm.Client) llm.Client {
+	if !config.Data.Cache.Enabled || messageDB == nil {
+		return client
+	}
+
+	return llm.NewCachingClient(client, messageDB, config.Data.Cache.TTL)
+}
+
+// cacheDisabled reports whether the channel opted out of cached responses
+func cacheDisabled(channelID string) bool {
+	return !config.Data.Cache.Enabled || slices.Contains(config.Data.Cache.DisabledChannels, channelID)
+}
+
+// earlierSummary returns a link to an earlier summary of the URL in the same guild, or an empty string
+func earlierSummary(msg *discordgo.MessageCreate, url string) string {
+	if !config.Data.Cache.LinkSummaries || messageDB == nil || msg.GuildID == "" || cacheDisabled(msg.ChannelID) {
+		return ""
+	}
+
+	summary, err := messageDB.GetSummary(url, msg.GuildID, time.Now().Add(-config.Data.Cache.TTL))
+	if err != nil {
+		zap.L().Error("failed to look up earlier summary", zap.Error(err))
+		return ""
+	}
+
+	if summary == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", summary.GuildID, summary.ChannelID, summary.MessageID)
+}
+
+// saveSummary records a reply that summarized the URL so later requests for it can link to it
+func saveSummary(msg *discordgo.MessageCreate, url string, reply *discordgo.Message) {
+	if !config.Data.Cache.LinkSummaries || messageDB == nil || msg.GuildID == "" {
+		return
+	}
+
+	err := messageDB.SaveSummary(url, db.Summary{GuildID: msg.GuildID, ChannelID: reply.ChannelID, MessageID: reply.ID})
+	if err != nil {
+		zap.L().Error("failed to save summary", zap.Error(err))
+	}
+}
@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The page fetcher's browser connects through a local proxy, so every connection it makes, including redirects and
+// subresources, goes to an address that was checked, and a DNS answer can't change between the check and the dial
+var (
+	fetchProxyOnce sync.Once
+	fetchProxyURL  string
+	fetchProxyErr  error
+)
+
+// startFetchProxy starts the proxy on a loopback port the first time it is needed and returns its URL
+func startFetchProxy() (string, error) {
+	fetchProxyOnce.Do(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fetchProxyErr = err
+			return
+		}
+
+		fetchProxyURL = "http://" + listener.Addr().String()
+		server := &http.Server{Handler: fetchProxy{}, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				zap.L().Error("fetch proxy stopped", zap.Error(err))
+			}
+		}()
+	})
+
+	return fetchProxyURL, fetchProxyErr
+}
+
+// dialPublic connects to a public address of the host, refusing hosts that resolve to internal addresses
+func dialPublic(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := publicAddresses(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	for _, ip := range addresses {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+
+	return nil, err
+}
+
+// fetchProxy tunnels HTTPS and forwards plain HTTP to public addresses only
+type fetchProxy struct{}
+
+var fetchProxyTransport = &http.Transport{
+	DialContext:         dialPublic,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+func (fetchProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		tunnel(w, r)
+		return
+	}
+
+	if r.URL.Host == "" {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	// Redirects come back to the browser, which requests the new location through the proxy again
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	resp, err := fetchProxyTransport.RoundTrip(r)
+	if err != nil {
+		zap.L().Warn("fetch proxy refused request", zap.String("host", r.URL.Host), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// tunnel connects a CONNECT request to a public address of its host and copies bytes both ways
+func tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := dialPublic(r.Context(), "tcp", r.Host)
+	if err != nil {
+		zap.L().Warn("fetch proxy refused tunnel", zap.String("host", r.Host), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		_, _ = io.Copy(upstream, buffered)
+	}()
+
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		_, _ = io.Copy(client, upstream)
+	}()
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+)
+
+func TestFetchProxyRefusesInternalHosts(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("metadata"))
+	}))
+	defer internal.Close()
+
+	internalTLS := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("metadata"))
+	}))
+	defer internalTLS.Close()
+
+	proxyURL, err := startFetchProxy()
+	if err != nil {
+		t.Fatalf("startFetchProxy: %v", err)
+	}
+
+	proxy, _ := neturl.Parse(proxyURL)
+	tlsTransport := internalTLS.Client().Transport.(*http.Transport).Clone()
+	tlsTransport.Proxy = http.ProxyURL(proxy)
+
+	tests := []struct {
+		name      string
+		url       string
+		transport *http.Transport
+	}{
+		{"forwarded", internal.URL, &http.Transport{Proxy: http.ProxyURL(proxy)}},
+		{"tunneled", internalTLS.URL, tlsTransport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := (&http.Client{Transport: tt.transport}).Get(tt.url)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				t.Errorf("%s reached through the proxy", tt.url)
+			}
+		})
+	}
+}
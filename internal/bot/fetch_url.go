@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const pageCacheTTL = time.Hour
+
+type conversationKey struct{}
+
+// withConversation attaches the ID of the conversation's root message to the context
+func withConversation(ctx context.Context, conversationID string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, conversationID)
+}
+
+func conversationFromContext(ctx context.Context) string {
+	conversationID, _ := ctx.Value(conversationKey{}).(string)
+	return conversationID
+}
+
+type cachedPage struct {
+	content    string
+	suspicious bool
+	fetchedAt  time.Time
+}
+
+// pageCache keeps extracted pages per conversation so follow-up questions don't launch the browser again
+type pageCache struct {
+	mu    sync.Mutex
+	pages map[string]cachedPage
+}
+
+var pages = &pageCache{pages: make(map[string]cachedPage)}
+
+func (c *pageCache) get(conversationID string, url string) (cachedPage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	page, ok := c.pages[conversationID+" "+url]
+	if !ok || time.Since(page.fetchedAt) > pageCacheTTL {
+		return cachedPage{}, false
+	}
+
+	return page, true
+}
+
+func (c *pageCache) put(conversationID string, url string, content string, suspicious bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, page := range c.pages {
+		if now.Sub(page.fetchedAt) > pageCacheTTL {
+			delete(c.pages, key)
+		}
+	}
+
+	c.pages[conversationID+" "+url] = cachedPage{content: content, suspicious: suspicious, fetchedAt: now}
+}
+
+// fetchPage extracts the readable content of a page, reusing the result within the same conversation and, with the
+// response cache enabled, across conversations, so a repeated link doesn't launch the browser again. It also reports
+// whether the page looks like it tries to instruct the model.
+func fetchPage(ctx context.Context, url string) (error, string, bool) {
+	conversationID := conversationFromContext(ctx)
+	if page, ok := pages.get(conversationID, url); ok {
+		zap.L().Debug("page cache hit", zap.String("url", url), zap.String("conversation", conversationID))
+		return nil, page.content, page.suspicious
+	}
+
+	if content, ok := storedPage(ctx, url); ok {
+		// Flagged again, since the page reaches a new conversation
+		suspicious := flagSuspiciousPage(conversationID, url, content)
+		pages.put(conversationID, url, content, suspicious)
+		return nil, content, suspicious
+	}
+
+	err, content := ParseURL(url)
+	if err != nil {
+		return err, "", false
+	}
+
+	suspicious := flagSuspiciousPage(conversationID, url, content)
+	pages.put(conversationID, url, content, suspicious)
+	storePage(ctx, url, content)
+	return nil, content, suspicious
+}
+
+// storedPage returns the content of the page from the database if the cache is enabled and has a fresh copy
+func storedPage(ctx context.Context, url string) (string, bool) {
+	if !config.Data.Cache.Enabled || messageDB == nil || llm.CacheDisabled(ctx) {
+		return "", false
+	}
+
+	content, ok, err := messageDB.GetCachedPage(url, time.Now().Add(-config.Data.Cache.TTL))
+	if err != nil {
+		zap.L().Error("failed to read page cache", zap.Error(err))
+		return "", false
+	}
+
+	if ok {
+		zap.L().Debug("stored page cache hit", zap.String("url", url))
+	}
+
+	return content, ok
+}
+
+func storePage(ctx context.Context, url string, content string) {
+	if !config.Data.Cache.Enabled || messageDB == nil || llm.CacheDisabled(ctx) {
+		return
+	}
+
+	if err := messageDB.SaveCachedPage(url, content); err != nil {
+		zap.L().Error("failed to save page to cache", zap.Error(err))
+	}
+
+	if err := messageDB.DeleteCachedPages(time.Now().Add(-config.Data.Cache.TTL)); err != nil {
+		zap.L().Error("failed to prune page cache", zap.Error(err))
+	}
+}
+
+// FetchURLTool lets the model pull in the content of any web page it decides it needs
+type FetchURLTool struct {
+	MaxTokens int
+}
+
+func NewFetchURLTool(maxTokens int) *FetchURLTool {
+	return &FetchURLTool{MaxTokens: maxTokens}
+}
+
+func (t *FetchURLTool) Name() string {
+	return "fetch_url"
+}
+
+func (t *FetchURLTool) Description() string {
+	return "Fetch a web page (article, tweet, Telegram post or PDF) and return its readable text content. " +
+		"Use it when answering requires the contents of a link mentioned in the conversation."
+}
+
+func (t *FetchURLTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"url": map[string]any{
+				"type":        "string",
+				"description": "Absolute https:// URL of the page",
+			},
+		},
+		"required": []string{"url"},
+	}
+}
+
+func (t *FetchURLTool) Execute(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	url := strings.TrimSpace(args.URL)
+	if !strings.HasPrefix(url, "https://") {
+		return "", errors.New("only https:// URLs are supported")
+	}
+
+	if err := checkPublicURL(ctx, url); err != nil {
+		zap.L().Warn("fetch_url rejected", zap.String("url", url), zap.Error(err))
+		return "", err
+	}
+
+	err, content, suspicious := fetchPage(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract page content: %w", err)
+	}
+
+	content, truncated := llm.TruncateToTokens(content, t.MaxTokens)
+	if truncated {
+		content += "\n[content truncated]"
+	}
+
+	return pageBlock(url, content, suspicious), nil
+}
+
+// checkPublicURL rejects URLs the model shouldn't make the browser open: hosts outside the configured allowlist and
+// hosts that resolve to loopback, private, link-local or otherwise internal addresses
+func checkPublicURL(ctx context.Context, rawURL string) error {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if host == "" {
+		return errors.New("URL has no host")
+	}
+
+	if allowed := config.Data.Tools.FetchURLAllowedHosts; len(allowed) > 0 {
+		if !slices.ContainsFunc(allowed, func(allowedHost string) bool {
+			allowedHost = strings.ToLower(allowedHost)
+			return host == allowedHost || strings.HasSuffix(host, "."+allowedHost)
+		}) {
+			return fmt.Errorf("host %s is not allowed", host)
+		}
+	}
+
+	_, err = publicAddresses(ctx, host)
+	return err
+}
+
+// publicAddresses resolves the host and returns its addresses, or an error if any of them is loopback, private,
+// link-local or otherwise internal
+func publicAddresses(ctx context.Context, host string) ([]netip.Addr, error) {
+	addresses, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	for i, address := range addresses {
+		address = address.Unmap()
+		if !address.IsGlobalUnicast() || address.IsPrivate() || address.IsLoopback() || address.IsLinkLocalUnicast() {
+			return nil, fmt.Errorf("host %s resolves to the internal address %s", host, address)
+		}
+
+		addresses[i] = address
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,327 @@
+package bot
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/db"
+	"discord-military-analyst-bot/internal/llm"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var imageGenerator llm.ImageGenerator
+
+const imagePromptSystem = "Rewrite the user's request into a single detailed prompt for an image generation model. " +
+	"Describe the subject, composition, style and lighting. If an original prompt and a requested change are given, " +
+	"apply the change to the original prompt. Keep it under 100 words. Reply with the prompt only."
+
+var imageExtensions = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/webp": "webp",
+	"image/gif":  "gif",
+}
+
+// remixMaxWords is the longest reply to a generated image that is taken as a change to it rather than a question
+const remixMaxWords = 15
+
+// remixVerbs are the words that make a reply to a generated image a request to change it
+var remixVerbs = []string{
+	"add", "again", "another", "change", "crop", "draw", "give", "make", "paint", "put", "recolor", "redo", "remix",
+	"remove", "render", "replace", "retry", "show", "swap", "try", "turn", "use", "zoom",
+}
+
+// wantsImage reports whether the message asks for an image, either with the keyword or with an edit instruction
+// replying to a generated one
+func wantsImage(msg *discordgo.MessageCreate) bool {
+	if imageGenerator == nil {
+		return false
+	}
+
+	keyword := config.Data.Discord.MakeImageKeyword
+	if keyword != "" && strings.Contains(msg.Content, keyword) {
+		return true
+	}
+
+	return remixInstruction(msg.Content) && previousGeneration(msg) != nil
+}
+
+// remixInstruction reports whether a reply to a generated image reads like a change to it ("again but darker", "make
+// it night"): a short reply without a question that starts with an edit verb, so thanks and chatter about the image
+// don't start a paid generation
+func remixInstruction(content string) bool {
+	if strings.Contains(content, "?") {
+		return false
+	}
+
+	words := instructionWords(content)
+	if len(words) == 0 || len(words) > remixMaxWords {
+		return false
+	}
+
+	// The verb may follow a word or two such as "now" or "please"
+	for _, word := range words[:min(len(words), 3)] {
+		if slices.Contains(remixVerbs, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// variationWords ask for the same image with a new seed rather than a change to it
+var variationWords = []string{"again", "another", "one", "more", "redo", "retry", "please"}
+
+// variationRequest reports whether a reply to a generated image only asks for a variation ("again", "another one")
+func variationRequest(content string) bool {
+	words := instructionWords(content)
+	return len(words) > 0 && !slices.ContainsFunc(words, func(word string) bool {
+		return !slices.Contains(variationWords, word)
+	})
+}
+
+// instructionWords returns the lowercase words of a reply without mentions and surrounding punctuation
+func instructionWords(content string) []string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(content)) {
+		if !strings.HasPrefix(word, "<@") {
+			words = append(words, strings.Trim(word, ".,!:;\"'"))
+		}
+	}
+
+	return words
+}
+
+// previousGeneration returns the parameters of the generated image the message replies to, if any
+func previousGeneration(msg *discordgo.MessageCreate) *db.ImageGeneration {
+	if messageDB == nil || msg.ReferencedMessage == nil {
+		return nil
+	}
+
+	generation, err := messageDB.GetImageGeneration(msg.ReferencedMessage.ID)
+	if err != nil {
+		zap.L().Error("failed to read image generation", zap.Error(err))
+		return nil
+	}
+
+	return generation
+}
+
+// sourceImage returns the first image attached to the message the message replies to, if any
+func sourceImage(msg *discordgo.MessageCreate) *discordgo.MessageAttachment {
+	if msg.ReferencedMessage == nil {
+		return nil
+	}
+
+	for _, attachment := range msg.ReferencedMessage.Attachments {
+		if llm.IsImageAttachment(attachment) {
+			return attachment
+		}
+	}
+
+	return nil
+}
+
+// handleImage generates an image from the message and replies with it as an attachment. Replies to an image edit it
+// if editing is configured, and replies to a generated image reuse its prompt, model, size and seed.
+func handleImage(ctx context.Context, msg *discordgo.MessageCreate, session *discordgo.Session, client llm.Client, info *llm.ResponseInfo) {
+	instruction := strings.TrimSpace(strings.ReplaceAll(msg.Content, config.Data.Discord.MakeImageKeyword, ""))
+	previous := previousGeneration(msg)
+	if previous != nil && variationRequest(instruction) {
+		instruction = ""
+	}
+	source := sourceImage(msg)
+
+	if instruction == "" && previous == nil && source == nil && msg.ReferencedMessage != nil {
+		instruction = strings.TrimSpace(msg.ReferencedMessage.Content)
+	}
+
+	if instruction == "" && previous == nil {
+		_, _ = sendOrEdit(session, msg, nil, "Tell me what to draw.")
+		return
+	}
+
+	if source != nil && previous == nil && config.Data.Images.EditMode == "" {
+		_, _ = sendOrEdit(session, msg, nil, "Editing images isn't enabled.")
+		return
+	}
+
+	request := llm.ImageRequest{
+		Model: config.Data.ImageModel,
+		Size:  config.Data.Images.Size,
+	}
+
+	if config.Data.Images.Seed {
+		seed := rand.IntN(math.MaxInt32)
+		request.Seed = &seed
+	}
+
+	// The prompt describes the whole image, so it can be reused by the next remix
+	prompt := instruction
+	if previous != nil {
+		request.Model = previous.Model
+		request.Size = previous.Size
+		prompt = previous.Prompt
+
+		// Without an instruction the user wants a variation, which needs a new seed
+		if instruction != "" {
+			request.Seed = previous.Seed
+			prompt = previous.Prompt + ". " + instruction
+		}
+	}
+
+	rewriteModel := ""
+	if config.Data.Images.RewritePrompt && instruction != "" {
+		message := instruction
+		if previous != nil {
+			message = "Original prompt: " + previous.Prompt + "\nRequested change: " + instruction
+		}
+
+		var rewritten string
+		if rewritten, rewriteModel = rewriteImagePrompt(ctx, msg, client, message); rewriteModel != "" {
+			prompt = rewritten
+		}
+	}
+	request.Prompt = prompt
+
+	// Edit models take the instruction rather than a description of the result
+	if source != nil && config.Data.Images.EditMode != "" {
+		request.Model = cmp.Or(config.Data.Images.EditModel, config.Data.ImageModel)
+		request.Prompt = cmp.Or(instruction, prompt)
+		request.Source = &llm.ImageSource{URL: source.URL, Filename: source.Filename, ContentType: source.ContentType}
+
+		if config.Data.Images.EditMode == "edits" {
+			data, _, err := llm.DownloadAttachment(ctx, source, config.Data.Vision.MaxImageBytes)
+			if err != nil {
+				zap.L().Error("failed to download image to edit", zap.Error(err))
+				_, _ = sendOrEdit(session, msg, nil, "Couldn't load the image to edit.")
+				return
+			}
+
+			request.Source.Data = data
+		}
+	}
+
+	zap.L().Info("generating image",
+		zap.String("model", request.Model),
+		zap.String("prompt", request.Prompt),
+		zap.Bool("edit", request.Source != nil),
+		zap.Bool("remix", previous != nil),
+	)
+	image, err := imageGenerator.GenerateImage(ctx, request)
+	if err != nil {
+		zap.L().Error("error generating image", zap.Error(err))
+		_, _ = sendOrEdit(session, msg, nil, errorReply(err))
+		return
+	}
+
+	if image.RevisedPrompt != "" {
+		prompt = image.RevisedPrompt
+	}
+
+	// Show the prompt if it isn't what the user wrote
+	content := ""
+	if prompt != instruction {
+		content = "> " + strings.ReplaceAll(prompt, "\n", " ")
+		if len(content) > 1999 {
+			content = content[:1999]
+		}
+	}
+
+	reply, err := sendImage(session, msg, content, image)
+	if err != nil {
+		zap.L().Error("error sending image", zap.Error(err))
+		return
+	}
+
+	if messageDB != nil {
+		if err := messageDB.SaveMessage(reply, true); err != nil {
+			zap.L().Error("failed to save image reply to database", zap.Error(err))
+		}
+
+		if err := messageDB.SetServedBy(reply.ID, request.Model); err != nil {
+			zap.L().Error("failed to record which model generated the image", zap.Error(err))
+		}
+
+		generation := db.ImageGeneration{
+			MessageID: reply.ID,
+			Prompt:    prompt,
+			Model:     request.Model,
+			Size:      request.Size,
+			Seed:      request.Seed,
+		}
+
+		if request.Source != nil {
+			// Remixes of an edit are generated from text, with the model that generates images
+			generation.Model = config.Data.ImageModel
+			generation.SourceURL = request.Source.URL
+		}
+
+		if err := messageDB.SaveImageGeneration(generation); err != nil {
+			zap.L().Error("failed to save image generation", zap.Error(err))
+		}
+	}
+
+	// Only the prompt rewrite uses tokens
+	if rewriteModel != "" && !info.Cached {
+		promptEstimate := contextBudget(rewriteModel).Estimate(imagePromptSystem, instruction, "", nil)
+		saveUsage(msg, reply.ID, info, rewriteModel, promptEstimate, prompt)
+	}
+}
+
+// rewriteImagePrompt asks the chat model for a better image prompt, falling back to the original one. The model is
+// returned if the prompt was rewritten.
+func rewriteImagePrompt(ctx context.Context, msg *discordgo.MessageCreate, client llm.Client, prompt string) (string, string) {
+	var roles []string
+	if msg.Member != nil {
+		roles = msg.Member.Roles
+	}
+
+	model := routeModel(routeRequest{Kind: "image", ChannelID: msg.ChannelID, Roles: roles})
+	request := llm.Request{
+		Model:   model,
+		System:  imagePromptSystem,
+		Message: prompt,
+		User:    msg.Author.ID,
+	}
+
+	rewritten, err := client.Infer(ctx, request)
+	rewritten = strings.TrimSpace(rewritten)
+	if err != nil || rewritten == "" {
+		zap.L().Warn("failed to rewrite image prompt, using the original", zap.Error(err))
+		return prompt, ""
+	}
+
+	zap.L().Debug("image prompt rewritten", zap.String("prompt", prompt), zap.String("rewritten", rewritten))
+	return rewritten, resolveModel(client, model)
+}
+
+// sendImage replies to the message with the image attached
+func sendImage(session *discordgo.Session, msg *discordgo.MessageCreate, content string, image *llm.Image) (*discordgo.Message, error) {
+	extension, ok := imageExtensions[image.ContentType]
+	if !ok {
+		extension = "png"
+	}
+
+	send := &discordgo.MessageSend{
+		Content: content,
+		Files: []*discordgo.File{{
+			Name:        "image." + extension,
+			ContentType: image.ContentType,
+			Reader:      bytes.NewReader(image.Data),
+		}},
+	}
+
+	if msg.GuildID != "" {
+		send.Reference = msg.Reference()
+	}
+
+	return session.ChannelMessageSendComplex(msg.ChannelID, send)
+}
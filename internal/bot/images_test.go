@@ -0,0 +1,47 @@
+package bot
+
+import "testing"
+
+func TestRemixInstruction(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"again but darker", true},
+		{"<@123> make it night", true},
+		{"now add a second tank.", true},
+		{"please remove the flag", true},
+		{"thanks!", false},
+		{"lol", false},
+		{"nice", false},
+		{"", false},
+		{"<@123>", false},
+		{"can you make it darker?", false},
+		{"that looks like a T-72 but the turret is wrong and I think the wheels should be different too", false},
+	}
+
+	for _, tt := range tests {
+		if got := remixInstruction(tt.content); got != tt.want {
+			t.Errorf("remixInstruction(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestVariationRequest(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"again", true},
+		{"<@123> another one please", true},
+		{"Redo!", true},
+		{"again but darker", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := variationRequest(tt.content); got != tt.want {
+			t.Errorf("variationRequest(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
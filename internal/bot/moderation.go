@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// Moderation actions from the least to the most severe
+var moderationActions = []string{"allow", "log", "spoiler", "refuse"}
+
+const (
+	refusedRequestReply  = "I can't help with that."
+	refusedResponseReply = "The response was withheld by moderation."
+)
+
+// moderationPolicy returns the guild's policy, the default one if it has none
+func moderationPolicy(guildID string) config.ModerationPolicy {
+	if policy, ok := config.Data.Moderation.Policies[guildID]; ok && guildID != "" {
+		return policy
+	}
+
+	return config.Data.Moderation.Policies["default"]
+}
+
+// moderationAction returns the most severe action the policy takes for the categories. Categories the policy
+// doesn't mention are refused unless it has a "*" action.
+func moderationAction(policy config.ModerationPolicy, categories []string) string {
+	fallback := policy.Actions["*"]
+	if fallback == "" {
+		fallback = "refuse"
+	}
+
+	// Flagged without categories, e.g. from a provider that only reports the verdict
+	if len(categories) == 0 {
+		return fallback
+	}
+
+	action := "allow"
+	for _, category := range categories {
+		categoryAction, ok := policy.Actions[category]
+		if !ok {
+			categoryAction = fallback
+		}
+
+		action = moreSevere(action, categoryAction)
+	}
+
+	return action
+}
+
+// withholdsResponses reports whether the policy can spoiler or refuse a response, in which case it can't be streamed
+// before it is checked
+func withholdsResponses(policy config.ModerationPolicy) bool {
+	// Categories the policy doesn't mention are refused
+	if _, ok := policy.Actions["*"]; !ok {
+		return true
+	}
+
+	for _, action := range policy.Actions {
+		if moreSevere("log", action) != "log" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func moreSevere(a string, b string) string {
+	if slices.Index(moderationActions, b) > slices.Index(moderationActions, a) {
+		return b
+	}
+
+	return a
+}
+
+// moderate checks the text of the given stage ("request" or "response") and returns the action to take. Flagged
+// text is reported to the guild's mod channel unless it is allowed. Moderation failures let the text through.
+func moderate(ctx context.Context, session *discordgo.Session, msg *discordgo.MessageCreate, moderator llm.Moderator, stage string, text string) string {
+	if moderator == nil || strings.TrimSpace(text) == "" {
+		return "allow"
+	}
+
+	result, err := moderator.Moderate(ctx, text)
+	if err != nil {
+		zap.L().Error("moderation failed, letting the text through", zap.String("stage", stage), zap.Error(err))
+		return "allow"
+	}
+
+	if !result.Flagged {
+		return "allow"
+	}
+
+	policy := moderationPolicy(msg.GuildID)
+	action := moderationAction(policy, result.Categories)
+	zap.L().Warn("content flagged",
+		zap.String("stage", stage),
+		zap.String("messageId", msg.ID),
+		zap.String("userId", msg.Author.ID),
+		zap.Strings("categories", result.Categories),
+		zap.String("action", action),
+	)
+
+	if action != "allow" && policy.ModChannel != "" {
+		reportModeration(session, msg, policy.ModChannel, stage, result.Categories, action, text)
+	}
+
+	return action
+}
+
+// reportModeration posts a flagged text to the mod channel without pinging anyone
+func reportModeration(session *discordgo.Session, msg *discordgo.MessageCreate, channelID string, stage string, categories []string, action string, text string) {
+	guildID := msg.GuildID
+	if guildID == "" {
+		guildID = "@me"
+	}
+
+	excerpt := strings.ReplaceAll(text, "||", "")
+	if runes := []rune(excerpt); len(runes) > 500 {
+		excerpt = string(runes[:500]) + "…"
+	}
+
+	report := fmt.Sprintf("**Flagged %s** (%s, action: %s) from <@%s> in <#%s>\nhttps://discord.com/channels/%s/%s/%s\n||%s||",
+		stage, strings.Join(categories, ", "), action, msg.Author.ID, msg.ChannelID, guildID, msg.ChannelID, msg.ID, excerpt)
+
+	_, err := session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         report,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		zap.L().Error("failed to report to the mod channel", zap.String("channelId", channelID), zap.Error(err))
+	}
+}
+
+// spoilered hides the text behind a spoiler, keeping it within Discord's message limit
+func spoilered(text string) string {
+	text = strings.ReplaceAll(text, "||", "")
+	if runes := []rune(text); len(runes) > 1995 {
+		text = string(runes[:1995])
+	}
+
+	return "||" + text + "||"
+}
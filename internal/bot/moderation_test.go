@@ -0,0 +1,30 @@
+package bot
+
+import (
+	"testing"
+
+	"discord-military-analyst-bot/internal/config"
+)
+
+func TestWithholdsResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions map[string]string
+		want    bool
+	}{
+		{"no policy", nil, true},
+		{"unlisted categories refused", map[string]string{"violence": "allow"}, true},
+		{"allow all", map[string]string{"*": "allow"}, false},
+		{"log only", map[string]string{"violence": "log", "*": "allow"}, false},
+		{"spoiler", map[string]string{"violence": "spoiler", "*": "allow"}, true},
+		{"refuse fallback", map[string]string{"violence": "allow", "*": "refuse"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withholdsResponses(config.ModerationPolicy{Actions: tt.actions}); got != tt.want {
+				t.Errorf("withholdsResponses(%v) = %v, want %v", tt.actions, got, tt.want)
+			}
+		})
+	}
+}
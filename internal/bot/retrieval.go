@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// retrievalCandidates is how many of the latest embedded messages of a channel are compared to the prompt
+const retrievalCandidates = 5000
+
+var embedder llm.Embedder
+
+// indexMessage stores the embedding of a message so later prompts can retrieve it
+func indexMessage(message *discordgo.Message) {
+	if embedder == nil || messageDB == nil || message == nil || strings.TrimSpace(message.Content) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	vectors, err := embedder.Embed(ctx, []string{message.Content})
+	if err == nil && len(vectors) == 0 {
+		err = errors.New("no embedding returned")
+	}
+	if err != nil {
+		zap.L().Error("failed to embed message", zap.String("messageId", message.ID), zap.Error(err))
+		return
+	}
+
+	err = messageDB.SaveEmbedding(message.ID, message.ChannelID, embedder.Model(), vectors[0])
+	if err != nil {
+		zap.L().Error("failed to save message embedding", zap.Error(err))
+	}
+}
+
+// relatedMessages returns the past messages of the channel most similar to the prompt, oldest first,
+// leaving out the current message and anything already in the history
+func relatedMessages(ctx context.Context, msg *discordgo.MessageCreate, prompt string, history []llm.HistoryItem) []llm.HistoryItem {
+	if embedder == nil || messageDB == nil || strings.TrimSpace(prompt) == "" {
+		return nil
+	}
+
+	vectors, err := embedder.Embed(ctx, []string{prompt})
+	if err == nil && len(vectors) == 0 {
+		err = errors.New("no embedding returned")
+	}
+	if err != nil {
+		zap.L().Error("failed to embed prompt", zap.Error(err))
+		return nil
+	}
+
+	candidates, err := messageDB.GetEmbeddedMessages(msg.ChannelID, embedder.Model(), retrievalCandidates)
+	if err != nil {
+		zap.L().Error("failed to load message embeddings", zap.Error(err))
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range history {
+		seen[item.Content] = true
+	}
+
+	type scored struct {
+		item       llm.HistoryItem
+		similarity float64
+	}
+
+	var matches []scored
+	for _, candidate := range candidates {
+		if candidate.ID == msg.ID || seen[candidate.Item.Content] {
+			continue
+		}
+
+		similarity := llm.CosineSimilarity(vectors[0], candidate.Vector)
+		if similarity < config.Data.Embeddings.MinSimilarity {
+			continue
+		}
+
+		seen[candidate.Item.Content] = true
+		matches = append(matches, scored{item: candidate.Item, similarity: similarity})
+	}
+
+	slices.SortFunc(matches, func(a, b scored) int {
+		switch {
+		case a.similarity > b.similarity:
+			return -1
+		case a.similarity < b.similarity:
+			return 1
+		default:
+			return 0
+		}
+	})
+	matches = matches[:min(len(matches), config.Data.Embeddings.TopK)]
+
+	related := make([]llm.HistoryItem, 0, len(matches))
+	for _, match := range matches {
+		related = append(related, match.item)
+	}
+
+	slices.SortFunc(related, func(a, b llm.HistoryItem) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	zap.L().Debug("retrieved related messages", zap.Int("candidates", len(candidates)), zap.Int("related", len(related)))
+	return related
+}
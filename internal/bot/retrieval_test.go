@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/db"
+	"discord-military-analyst-bot/internal/llm"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeEmbedder returns a fixed vector for every known text
+type fakeEmbedder map[string][]float32
+
+func (e fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e[text]
+	}
+	return vectors, nil
+}
+
+func (e fakeEmbedder) Model() string {
+	return "fake"
+}
+
+func TestRelatedMessages(t *testing.T) {
+	vectors := fakeEmbedder{
+		"prompt":          {1, 0},
+		"oldest, close":   {0.9, 0.1},
+		"unrelated":       {0, 1},
+		"in history":      {1, 0},
+		"middle, weakest": {0.6, 0.4},
+		"newest, closest": {1, 0.05},
+		"current":         {1, 0},
+	}
+
+	messages, err := db.New(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("db.New: %v", err)
+	}
+
+	previousDB, previousEmbedder, previousConfig := messageDB, embedder, config.Data
+	messageDB, embedder = messages, vectors
+	config.Data = &config.Config{Embeddings: config.EmbeddingsConfig{TopK: 2, MinSimilarity: 0.5}}
+	t.Cleanup(func() {
+		_ = messages.Close()
+		messageDB, embedder, config.Data = previousDB, previousEmbedder, previousConfig
+	})
+
+	// Saved oldest first, so the creation order differs from the similarity order
+	for i, content := range []string{"oldest, close", "unrelated", "in history", "middle, weakest", "newest, closest", "current"} {
+		message := &discordgo.Message{ID: string(rune('a' + i)), ChannelID: "channel", Content: content, Author: &discordgo.User{ID: "user"}}
+		if err := messages.SaveMessage(message, false); err != nil {
+			t.Fatalf("SaveMessage: %v", err)
+		}
+		indexMessage(message)
+	}
+
+	msg := &discordgo.MessageCreate{Message: &discordgo.Message{ID: "f", ChannelID: "channel"}}
+	history := []llm.HistoryItem{{Content: "in history"}}
+
+	var got []string
+	for _, item := range relatedMessages(context.Background(), msg, "prompt", history) {
+		got = append(got, item.Content)
+	}
+
+	// The two most similar messages, oldest first, without the current message, history or weak matches
+	want := []string{"oldest, close", "newest, closest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("relatedMessages = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// routeRequest describes the request the routing rules are matched against
+type routeRequest struct {
+	Kind      string // "chat", "url" or "image"
+	Images    bool
+	Tokens    int
+	ChannelID string
+	Roles     []string
+}
+
+// routeModel returns the model of the first routing rule that matches the request, or the configured model
+// if none does
+func routeModel(request routeRequest) string {
+	for _, rule := range config.Data.Routes {
+		if !routeMatches(rule, request) {
+			continue
+		}
+
+		zap.L().Info("request routed",
+			zap.String("rule", rule.Name),
+			zap.String("model", rule.Model),
+			zap.String("kind", request.Kind),
+			zap.Bool("images", request.Images),
+			zap.Int("estimatedTokens", request.Tokens),
+		)
+		return rule.Model
+	}
+
+	zap.L().Info("request routed", zap.String("rule", "default"), zap.String("model", config.Data.Model))
+	return config.Data.Model
+}
+
+func routeMatches(rule config.RouteRule, request routeRequest) bool {
+	if rule.Kind != "" && rule.Kind != request.Kind {
+		return false
+	}
+
+	if rule.Images != nil && *rule.Images != request.Images {
+		return false
+	}
+
+	if rule.MinTokens > 0 && request.Tokens < rule.MinTokens {
+		return false
+	}
+
+	if rule.MaxTokens > 0 && request.Tokens > rule.MaxTokens {
+		return false
+	}
+
+	if len(rule.Channels) > 0 && !slices.Contains(rule.Channels, request.ChannelID) {
+		return false
+	}
+
+	if len(rule.Roles) > 0 && !slices.ContainsFunc(request.Roles, func(role string) bool {
+		return slices.Contains(rule.Roles, role)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// hasImages reports whether any message of the history carries an image the model will see
+func hasImages(history []llm.HistoryItem) bool {
+	if !config.Data.Vision.Enabled {
+		return false
+	}
+
+	for _, item := range history {
+		for _, attachment := range item.Attachments {
+			if llm.IsImageAttachment(attachment) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
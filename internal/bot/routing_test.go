@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"testing"
+
+	"discord-military-analyst-bot/internal/config"
+)
+
+func TestRouteMatches(t *testing.T) {
+	withImages, withoutImages := true, false
+
+	request := routeRequest{Kind: "chat", Images: true, Tokens: 5000, ChannelID: "news", Roles: []string{"member", "analyst"}}
+
+	tests := []struct {
+		name string
+		rule config.RouteRule
+		want bool
+	}{
+		{"empty rule", config.RouteRule{}, true},
+		{"kind", config.RouteRule{Kind: "chat"}, true},
+		{"other kind", config.RouteRule{Kind: "url"}, false},
+		{"images", config.RouteRule{Images: &withImages}, true},
+		{"no images", config.RouteRule{Images: &withoutImages}, false},
+		{"min tokens", config.RouteRule{MinTokens: 5000}, true},
+		{"below min tokens", config.RouteRule{MinTokens: 5001}, false},
+		{"max tokens", config.RouteRule{MaxTokens: 5000}, true},
+		{"above max tokens", config.RouteRule{MaxTokens: 4999}, false},
+		{"channel", config.RouteRule{Channels: []string{"general", "news"}}, true},
+		{"other channel", config.RouteRule{Channels: []string{"general"}}, false},
+		{"any role", config.RouteRule{Roles: []string{"admin", "analyst"}}, true},
+		{"no role", config.RouteRule{Roles: []string{"admin"}}, false},
+		{"all conditions", config.RouteRule{Kind: "chat", Images: &withImages, MinTokens: 1000, MaxTokens: 8000, Channels: []string{"news"}, Roles: []string{"analyst"}}, true},
+		{"one condition fails", config.RouteRule{Kind: "chat", Images: &withImages, MinTokens: 1000, MaxTokens: 8000, Channels: []string{"general"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeMatches(tt.rule, request); got != tt.want {
+				t.Errorf("routeMatches(%+v) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteModel(t *testing.T) {
+	previous := config.Data
+	t.Cleanup(func() { config.Data = previous })
+
+	config.Data = &config.Config{
+		Model: "default-model",
+		Routes: []config.RouteRule{
+			{Name: "long", Kind: "chat", MinTokens: 10000, Model: "long-context"},
+			{Name: "urls", Kind: "url", Model: "fast"},
+			{Name: "all urls", Kind: "url", Model: "never-reached"},
+		},
+	}
+
+	tests := []struct {
+		request routeRequest
+		want    string
+	}{
+		{routeRequest{Kind: "chat", Tokens: 20000}, "long-context"},
+		{routeRequest{Kind: "url"}, "fast"},
+		{routeRequest{Kind: "chat", Tokens: 100}, "default-model"},
+	}
+
+	for _, tt := range tests {
+		if got := routeModel(tt.request); got != tt.want {
+			t.Errorf("routeModel(%+v) = %q, want %q", tt.request, got, tt.want)
+		}
+	}
+}
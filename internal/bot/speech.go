@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var synthesizer llm.Synthesizer
+
+var audioContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm", // raw 24 kHz 16-bit mono samples without a header
+}
+
+// Markdown that would be read out loud
+var markdownReplacer = strings.NewReplacer("**", "", "__", "", "||", "", "`", "", "#", "", "*", "")
+
+// wantsSpeech reports whether the reply to the message should also be spoken
+func wantsSpeech(msg *discordgo.MessageCreate) bool {
+	if synthesizer == nil {
+		return false
+	}
+
+	keyword := config.Data.Discord.SpeakKeyword
+	if keyword != "" && strings.Contains(msg.Content, keyword) {
+		return true
+	}
+
+	return slices.Contains(config.Data.Speech.Channels, msg.ChannelID)
+}
+
+// speechVoice returns the voice of the persona answering
+func speechVoice(ignoreSystemPrompt bool) string {
+	persona := "default"
+	if ignoreSystemPrompt {
+		persona = "raw"
+	}
+
+	if voice := config.Data.Speech.Voices[persona]; voice != "" {
+		return voice
+	}
+
+	return config.Data.Speech.Voice
+}
+
+// attachSpeech speaks the reply text and attaches the audio to the reply, returning the updated reply
+func attachSpeech(ctx context.Context, session *discordgo.Session, reply *discordgo.Message, text string, voice string) *discordgo.Message {
+	text = strings.TrimSpace(markdownReplacer.Replace(text))
+	if runes := []rune(text); len(runes) > config.Data.Speech.MaxChars {
+		text = string(runes[:config.Data.Speech.MaxChars])
+	}
+
+	audio, err := synthesizer.Synthesize(ctx, text, voice)
+	if err != nil {
+		zap.L().Error("failed to synthesize speech", zap.Error(err))
+		return reply
+	}
+
+	format := config.Data.Speech.Format
+	edit := discordgo.NewMessageEdit(reply.ChannelID, reply.ID)
+	edit.Files = []*discordgo.File{{
+		Name:        "reply." + format,
+		ContentType: audioContentTypes[format],
+		Reader:      bytes.NewReader(audio),
+	}}
+
+	updated, err := session.ChannelMessageEditComplex(edit)
+	if err != nil {
+		zap.L().Error("failed to attach speech to reply", zap.Error(err))
+		return reply
+	}
+
+	zap.L().Debug("speech attached", zap.String("messageId", reply.ID), zap.String("voice", voice), zap.Int("bytes", len(audio)))
+	return updated
+}
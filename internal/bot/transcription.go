@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var transcriber llm.Transcriber
+
+// transcribeAttachments returns the transcripts of the audio attachments of a message, or an empty string
+// if there are none
+func transcribeAttachments(ctx context.Context, messageID string, attachments []*discordgo.MessageAttachment) string {
+	if transcriber == nil {
+		return ""
+	}
+
+	var transcripts []string
+	for _, attachment := range attachments {
+		if !llm.IsAudioAttachment(attachment) {
+			continue
+		}
+
+		transcript, err := transcribeAttachment(ctx, messageID, attachment)
+		if err != nil {
+			zap.L().Warn("failed to transcribe audio attachment", zap.String("filename", attachment.Filename), zap.Error(err))
+			continue
+		}
+
+		if transcript != "" {
+			transcripts = append(transcripts, transcript)
+		}
+	}
+
+	if len(transcripts) == 0 {
+		return ""
+	}
+
+	return "[Voice message transcript] " + strings.Join(transcripts, "\n")
+}
+
+// transcribeAttachment returns the stored transcript of the attachment, transcribing and storing it if there is none
+func transcribeAttachment(ctx context.Context, messageID string, attachment *discordgo.MessageAttachment) (string, error) {
+	if messageDB != nil {
+		transcript, ok, err := messageDB.GetTranscript(attachment.ID)
+		if err != nil {
+			zap.L().Error("failed to read transcript", zap.Error(err))
+		} else if ok {
+			return transcript, nil
+		}
+	}
+
+	audio, _, err := llm.DownloadAttachment(ctx, attachment, config.Data.Transcription.MaxBytes)
+	if err != nil {
+		return "", err
+	}
+
+	transcript, err := transcriber.Transcribe(ctx, attachment.Filename, audio)
+	if err != nil {
+		return "", err
+	}
+
+	zap.L().Debug("transcribed audio attachment", zap.String("filename", attachment.Filename), zap.Int("length", len(transcript)))
+	if messageDB != nil {
+		// Empty transcripts are stored too, so silence isn't sent to the endpoint again
+		if err := messageDB.SaveTranscript(messageID, attachment.ID, transcript); err != nil {
+			zap.L().Error("failed to save transcript", zap.Error(err))
+		}
+	}
+
+	return transcript, nil
+}
+
+// withTranscripts adds the transcripts of the audio attachments of user messages to their content
+func withTranscripts(ctx context.Context, history []llm.HistoryItem) []llm.HistoryItem {
+	if transcriber == nil {
+		return history
+	}
+
+	transcribed := make([]llm.HistoryItem, 0, len(history))
+	for _, item := range history {
+		if !item.IsBotMessage {
+			if transcript := transcribeAttachments(ctx, item.ID, item.Attachments); transcript != "" {
+				item.Content = strings.TrimSpace(item.Content + "\n" + transcript)
+			}
+		}
+
+		transcribed = append(transcribed, item)
+	}
+
+	return transcribed
+}
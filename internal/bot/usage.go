@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/db"
+	"discord-military-analyst-bot/internal/llm"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+type quota struct {
+	name  string
+	limit int
+	since time.Time
+	used  func(id string, since time.Time) (int, error)
+	id    string
+	reply string
+}
+
+// exceededQuota returns the first quota the message's author or guild has used up, or nil.
+// The superuser is never limited.
+func exceededQuota(msg *discordgo.MessageCreate) *quota {
+	if messageDB == nil || msg.Author.ID == config.Data.Discord.SuperuserId {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	quotas := []quota{
+		{"user daily", config.Data.Quota.UserDaily, day, messageDB.GetUserTokens, msg.Author.ID, "You've used up your daily quota, try again tomorrow"},
+		{"user monthly", config.Data.Quota.UserMonthly, month, messageDB.GetUserTokens, msg.Author.ID, "You've used up your monthly quota, see you next month"},
+	}
+
+	if msg.GuildID != "" {
+		quotas = append(quotas,
+			quota{"guild daily", config.Data.Quota.GuildDaily, day, messageDB.GetGuildTokens, msg.GuildID, "This server has used up its daily quota, try again tomorrow"},
+			quota{"guild monthly", config.Data.Quota.GuildMonthly, month, messageDB.GetGuildTokens, msg.GuildID, "This server has used up its monthly quota, see you next month"},
+		)
+	}
+
+	for _, q := range quotas {
+		if q.limit <= 0 {
+			continue
+		}
+
+		used, err := q.used(q.id, q.since)
+		if err != nil {
+			zap.L().Error("failed to get token usage", zap.String("quota", q.name), zap.Error(err))
+			continue
+		}
+
+		if used >= q.limit {
+			zap.L().Info("quota exceeded", zap.String("quota", q.name), zap.String("id", q.id), zap.Int("used", used), zap.Int("limit", q.limit))
+			return &q
+		}
+	}
+
+	return nil
+}
+
+// saveUsage records the tokens used for a reply. If the provider didn't report usage, the prompt estimate and
+// the length of the response are used instead.
+func saveUsage(msg *discordgo.MessageCreate, replyID string, info *llm.ResponseInfo, model string, promptEstimate int, response string) {
+	if messageDB == nil {
+		return
+	}
+
+	usage := db.Usage{
+		MessageID:        replyID,
+		UserID:           msg.Author.ID,
+		ChannelID:        msg.ChannelID,
+		GuildID:          msg.GuildID,
+		Model:            model,
+		PromptTokens:     info.Usage.PromptTokens,
+		CompletionTokens: info.Usage.CompletionTokens,
+	}
+
+	if info.Model != "" {
+		usage.Model = info.Model
+	}
+
+	if usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		usage.PromptTokens = promptEstimate
+		usage.CompletionTokens = contextBudget(usage.Model).Estimator.Count(response)
+		usage.Estimated = true
+	}
+
+	if price, ok := config.Data.Prices[usage.Model]; ok {
+		usage.Cost = (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+	}
+
+	zap.L().Debug("token usage",
+		zap.String("model", usage.Model),
+		zap.Int("promptTokens", usage.PromptTokens),
+		zap.Int("completionTokens", usage.CompletionTokens),
+		zap.Float64("cost", usage.Cost),
+		zap.Bool("estimated", usage.Estimated),
+	)
+
+	if err := messageDB.SaveUsage(usage); err != nil {
+		zap.L().Error("failed to save token usage", zap.Error(err))
+	}
+}
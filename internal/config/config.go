@@ -1,6 +1,10 @@
 package config
 
 import (
+	"encoding/json"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -10,6 +14,9 @@ type LLMProvider int8
 
 const (
 	OpenAI LLMProvider = iota
+	Anthropic
+	Ollama
+	Gemini
 )
 
 type Environment int8
@@ -28,6 +35,7 @@ type DiscordConfig struct {
 	Typing              bool
 	IgnoreSystemKeyword string
 	MakeImageKeyword    string
+	SpeakKeyword        string
 	AllowDM             bool
 	DisableSystemForDM  bool
 }
@@ -39,6 +47,197 @@ type OpenAIConfig struct {
 	Temperature   float64
 }
 
+type RetryConfig struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+type AnthropicConfig struct {
+	Endpoint    string
+	ApiKey      string
+	Version     string
+	MaxTokens   int
+	Temperature float64
+}
+
+type GeminiConfig struct {
+	Endpoint    string
+	ApiKey      string
+	MaxTokens   int
+	Temperature float64
+}
+
+// OllamaModelOptions are the Ollama request options; zero values are left to the server defaults
+type OllamaModelOptions struct {
+	KeepAlive     string   `json:"keep_alive"`
+	NumCtx        int      `json:"num_ctx"`
+	NumPredict    int      `json:"num_predict"`
+	RepeatPenalty float64  `json:"repeat_penalty"`
+	Temperature   *float64 `json:"temperature"`
+}
+
+type OllamaConfig struct {
+	Endpoint string
+	Defaults OllamaModelOptions
+	Models   map[string]OllamaModelOptions
+}
+
+type VisionConfig struct {
+	Enabled       bool
+	InlineImages  bool // download images and send them as base64 data URLs instead of Discord CDN links
+	MaxImages     int
+	MaxImageBytes int
+	Models        []string // models that accept images, matched as substrings; all of them if empty
+}
+
+type ToolsConfig struct {
+	Enabled  bool
+	MaxSteps int // tool-calling rounds before the model is made to answer without tools
+
+	FetchURLMaxTokens    int      // budget for the page content returned by fetch_url
+	FetchURLAllowedHosts []string // hosts fetch_url may open, with their subdomains; any public host if empty
+}
+
+type ModelContext struct {
+	Window        int     `json:"window"`
+	CharsPerToken float64 `json:"chars_per_token"`
+}
+
+type ContextConfig struct {
+	Window          int // no limit if zero, unless set per model
+	ResponseReserve int
+	CharsPerToken   float64
+	Models          map[string]ModelContext
+}
+
+// ProviderConfig is a named backend. Settings left empty are taken from the block of its kind (OPENAI_*, ...).
+type ProviderConfig struct {
+	Kind     string `json:"kind"`
+	Endpoint string `json:"endpoint"`
+	ApiKey   string `json:"api_key"`
+	Model    string `json:"model"`
+}
+
+// AliasConfig maps a role such as "fast" or "vision" to a named provider and a model
+type AliasConfig struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+type FallbackTarget struct {
+	Provider string `json:"provider"`
+	Endpoint string `json:"endpoint"`
+	ApiKey   string `json:"api_key"`
+	Model    string `json:"model"`
+}
+
+type FallbackConfig struct {
+	Name             string // the chain is registered as a provider under this name
+	Targets          []FallbackTarget
+	FailureThreshold int
+	ProbeInterval    time.Duration
+}
+
+// RouteRule sends the requests it matches to a model. Conditions left empty match any request.
+type RouteRule struct {
+	Name      string   `json:"name"`
+	Model     string   `json:"model"` // a model name, a provider name or an alias
+	Kind      string   `json:"kind"`  // "chat", "url" (a page to summarize) or "image" (an image prompt to rewrite)
+	Images    *bool    `json:"images"`
+	MinTokens int      `json:"min_tokens"` // estimated prompt size
+	MaxTokens int      `json:"max_tokens"`
+	Channels  []string `json:"channels"`
+	Roles     []string `json:"roles"` // matches if the author has any of the role IDs
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// QuotaConfig limits the tokens used per calendar day and month (UTC), zero means unlimited
+type QuotaConfig struct {
+	UserDaily      int
+	UserMonthly    int
+	GuildDaily     int
+	GuildMonthly   int
+	DowngradeModel string // used instead of refusing once a quota is exceeded, if set
+}
+
+type ReasoningConfig struct {
+	Display             string   // "hidden", "status" (a thinking… message) or "spoiler" (the reasoning so far under a spoiler)
+	ImplicitThinkModels []string // models whose chat template opens the <think> span, matched as substrings
+}
+
+type CacheConfig struct {
+	Enabled          bool
+	TTL              time.Duration
+	DisabledChannels []string
+	LinkSummaries    bool // reply to a link summarized before with a link to the earlier summary
+}
+
+// EmbeddingsConfig enables semantic retrieval of past messages when a provider is set
+type EmbeddingsConfig struct {
+	Provider      string // "openai" or "ollama"
+	Endpoint      string
+	ApiKey        string
+	Model         string
+	TopK          int
+	MinSimilarity float64
+}
+
+// TranscriptionConfig enables speech-to-text for audio attachments when an endpoint is set
+type TranscriptionConfig struct {
+	Endpoint string // OpenAI-compatible /audio/transcriptions URL
+	ApiKey   string
+	Model    string
+	Language string // ISO-639-1 hint, detected by the model if empty
+	MaxBytes int
+}
+
+// SpeechConfig enables spoken replies when an endpoint is set. Voices maps a persona to a voice: "default" is
+// the system prompt persona, "raw" is used when the system prompt is ignored.
+type SpeechConfig struct {
+	Endpoint string // OpenAI-compatible /audio/speech URL
+	ApiKey   string
+	Model    string
+	Voice    string
+	Voices   map[string]string
+	Format   string
+	Channels []string // channels where every reply is spoken
+	MaxChars int
+}
+
+// ImagesConfig configures image generation, which uses OPENAI_IMG_ENDPOINT and IMAGE_MODEL
+type ImagesConfig struct {
+	Size           string
+	ResponseFormat string // "b64_json" or "url", the provider's default if empty
+	RewritePrompt  bool   // let the chat model turn the message into a better image prompt first
+	Seed           bool   // send a random seed, which is stored so remixes can reuse it
+	EditMode       string // "edits" (/images/edits), "img2img" (image_url sent to the generation endpoint) or empty
+	EditEndpoint   string
+	EditModel      string
+}
+
+// ModerationPolicy maps flagged categories to actions for a guild. Actions are "allow", "log", "spoiler" and
+// "refuse"; "*" applies to flagged categories without an action of their own.
+type ModerationPolicy struct {
+	Actions    map[string]string `json:"actions"`
+	ModChannel string            `json:"mod_channel"` // flagged content is reported here unless it is allowed
+}
+
+// ModerationConfig enables checking requests and responses when a provider is set
+type ModerationConfig struct {
+	Provider   string // "openai" for a /moderations endpoint or "llm" for a classifier prompt
+	Endpoint   string
+	ApiKey     string
+	Model      string
+	Categories []string                    // categories the classifier checks
+	Policies   map[string]ModerationPolicy // keyed by guild ID, "default" applies to the others and to DMs
+}
+
 type DatabaseConfig struct {
 	Path string
 }
@@ -46,12 +245,34 @@ type DatabaseConfig struct {
 type Config struct {
 	Discord    DiscordConfig
 	OpenAI     OpenAIConfig
+	Retry      RetryConfig
+	Anthropic  AnthropicConfig
+	Ollama     OllamaConfig
+	Gemini     GeminiConfig
+	Vision     VisionConfig
+	Tools      ToolsConfig
+	Context    ContextConfig
+	Fallback   FallbackConfig
 	Database   DatabaseConfig
 	Provider   LLMProvider
 	Model      string
 	ImageModel string
 	LogLevel   zapcore.Level
 	EnvType    Environment
+
+	Providers       map[string]ProviderConfig
+	Aliases         map[string]AliasConfig
+	DefaultProvider string
+	Routes          []RouteRule
+	Quota           QuotaConfig
+	Prices          map[string]ModelPrice
+	Reasoning       ReasoningConfig
+	Cache           CacheConfig
+	Embeddings      EmbeddingsConfig
+	Transcription   TranscriptionConfig
+	Speech          SpeechConfig
+	Images          ImagesConfig
+	Moderation      ModerationConfig
 }
 
 var Data *Config = nil
@@ -89,13 +310,11 @@ func Init() {
 
 	InitLogger()
 
-	providerString := viper.Get("LLM_PROVIDER")
-	switch providerString {
-	case "openai":
-		config.Provider = OpenAI
-	default:
-		config.Provider = OpenAI
+	provider, ok := ParseProvider(viper.GetString("LLM_PROVIDER"))
+	if !ok {
+		provider = OpenAI
 	}
+	config.Provider = provider
 
 	envString := viper.Get("APP_ENV")
 	switch envString {
@@ -114,6 +333,7 @@ func Init() {
 		BonkFromAnyone:      viper.GetBool("DISCORD_BONK_FROM_ANYONE"),
 		IgnoreSystemKeyword: viper.GetString("DISCORD_IGNORE_SYSTEM_KEYWORD"),
 		MakeImageKeyword:    viper.GetString("DISCORD_MAKE_IMAGE_KEYWORD"),
+		SpeakKeyword:        viper.GetString("DISCORD_SPEAK_KEYWORD"),
 		Typing:              viper.GetBool("DISCORD_TYPING"),
 		AllowDM:             viper.GetBool("DISCORD_ALLOW_DM"),
 		DisableSystemForDM:  viper.GetBool("DISCORD_DM_CLEAN_SYSTEM"),
@@ -126,6 +346,337 @@ func Init() {
 		Temperature:   viper.GetFloat64("OPENAI_TEMPERATURE"),
 	}
 
+	config.Retry = RetryConfig{
+		Attempts:  viper.GetInt("RETRY_ATTEMPTS"),
+		BaseDelay: viper.GetDuration("RETRY_BASE_DELAY"),
+		MaxDelay:  viper.GetDuration("RETRY_MAX_DELAY"),
+	}
+
+	if config.Retry.Attempts <= 0 {
+		config.Retry.Attempts = 3
+	}
+
+	if config.Retry.BaseDelay <= 0 {
+		config.Retry.BaseDelay = 500 * time.Millisecond
+	}
+
+	if config.Retry.MaxDelay <= 0 {
+		config.Retry.MaxDelay = 30 * time.Second
+	}
+
+	config.Anthropic = AnthropicConfig{
+		Endpoint:    viper.GetString("ANTHROPIC_ENDPOINT"),
+		ApiKey:      viper.GetString("ANTHROPIC_API_KEY"),
+		Version:     viper.GetString("ANTHROPIC_VERSION"),
+		MaxTokens:   viper.GetInt("ANTHROPIC_MAX_TOKENS"),
+		Temperature: viper.GetFloat64("ANTHROPIC_TEMPERATURE"),
+	}
+
+	config.Gemini = GeminiConfig{
+		Endpoint:    viper.GetString("GEMINI_ENDPOINT"),
+		ApiKey:      viper.GetString("GEMINI_API_KEY"),
+		MaxTokens:   viper.GetInt("GEMINI_MAX_TOKENS"),
+		Temperature: viper.GetFloat64("GEMINI_TEMPERATURE"),
+	}
+
+	config.Ollama = OllamaConfig{
+		Endpoint: viper.GetString("OLLAMA_ENDPOINT"),
+		Defaults: OllamaModelOptions{
+			KeepAlive:     viper.GetString("OLLAMA_KEEP_ALIVE"),
+			NumCtx:        viper.GetInt("OLLAMA_NUM_CTX"),
+			NumPredict:    viper.GetInt("OLLAMA_NUM_PREDICT"),
+			RepeatPenalty: viper.GetFloat64("OLLAMA_REPEAT_PENALTY"),
+		},
+		Models: make(map[string]OllamaModelOptions),
+	}
+
+	if viper.GetString("OLLAMA_TEMPERATURE") != "" {
+		temperature := viper.GetFloat64("OLLAMA_TEMPERATURE")
+		config.Ollama.Defaults.Temperature = &temperature
+	}
+
+	if modelOptions := viper.GetString("OLLAMA_MODEL_OPTIONS"); modelOptions != "" {
+		if err := json.Unmarshal([]byte(modelOptions), &config.Ollama.Models); err != nil {
+			zap.L().Fatal("invalid OLLAMA_MODEL_OPTIONS", zap.Error(err))
+		}
+	}
+
+	config.Vision = VisionConfig{
+		Enabled:       viper.GetBool("VISION_ENABLED"),
+		InlineImages:  viper.GetBool("VISION_INLINE_IMAGES"),
+		MaxImages:     viper.GetInt("VISION_MAX_IMAGES"),
+		MaxImageBytes: viper.GetInt("VISION_MAX_IMAGE_BYTES"),
+		Models:        splitList(viper.GetString("VISION_MODELS")),
+	}
+
+	if config.Vision.MaxImages <= 0 {
+		config.Vision.MaxImages = 4
+	}
+
+	if config.Vision.MaxImageBytes <= 0 {
+		config.Vision.MaxImageBytes = 20 * 1024 * 1024
+	}
+
+	config.Tools = ToolsConfig{
+		Enabled:  viper.GetBool("TOOLS_ENABLED"),
+		MaxSteps: viper.GetInt("TOOLS_MAX_STEPS"),
+
+		FetchURLMaxTokens:    viper.GetInt("TOOLS_FETCH_URL_MAX_TOKENS"),
+		FetchURLAllowedHosts: splitList(viper.GetString("TOOLS_FETCH_URL_ALLOWED_HOSTS")),
+	}
+
+	if config.Tools.MaxSteps <= 0 {
+		config.Tools.MaxSteps = 4
+	}
+
+	if config.Tools.FetchURLMaxTokens <= 0 {
+		config.Tools.FetchURLMaxTokens = 4000
+	}
+
+	config.Context = ContextConfig{
+		Window:          viper.GetInt("CONTEXT_WINDOW"),
+		ResponseReserve: viper.GetInt("CONTEXT_RESPONSE_RESERVE"),
+		CharsPerToken:   viper.GetFloat64("CONTEXT_CHARS_PER_TOKEN"),
+		Models:          make(map[string]ModelContext),
+	}
+
+	if config.Context.ResponseReserve <= 0 {
+		config.Context.ResponseReserve = 1024
+	}
+
+	if modelContexts := viper.GetString("CONTEXT_MODELS"); modelContexts != "" {
+		if err := json.Unmarshal([]byte(modelContexts), &config.Context.Models); err != nil {
+			zap.L().Fatal("invalid CONTEXT_MODELS", zap.Error(err))
+		}
+	}
+
+	config.Providers = make(map[string]ProviderConfig)
+	if providers := viper.GetString("PROVIDERS"); providers != "" {
+		if err := json.Unmarshal([]byte(providers), &config.Providers); err != nil {
+			zap.L().Fatal("invalid PROVIDERS", zap.Error(err))
+		}
+	}
+
+	for name, provider := range config.Providers {
+		if _, ok := ParseProvider(provider.Kind); !ok {
+			zap.L().Fatal("unknown provider kind", zap.String("provider", name), zap.String("kind", provider.Kind))
+		}
+	}
+
+	config.Aliases = make(map[string]AliasConfig)
+	if aliases := viper.GetString("MODEL_ALIASES"); aliases != "" {
+		if err := json.Unmarshal([]byte(aliases), &config.Aliases); err != nil {
+			zap.L().Fatal("invalid MODEL_ALIASES", zap.Error(err))
+		}
+	}
+
+	if routes := viper.GetString("ROUTING_RULES"); routes != "" {
+		if err := json.Unmarshal([]byte(routes), &config.Routes); err != nil {
+			zap.L().Fatal("invalid ROUTING_RULES", zap.Error(err))
+		}
+	}
+
+	for _, route := range config.Routes {
+		if route.Model == "" || (route.Kind != "" && route.Kind != "chat" && route.Kind != "url" && route.Kind != "image") {
+			zap.L().Fatal("invalid routing rule", zap.String("rule", route.Name))
+		}
+	}
+
+	config.Quota = QuotaConfig{
+		UserDaily:      viper.GetInt("QUOTA_USER_DAILY_TOKENS"),
+		UserMonthly:    viper.GetInt("QUOTA_USER_MONTHLY_TOKENS"),
+		GuildDaily:     viper.GetInt("QUOTA_GUILD_DAILY_TOKENS"),
+		GuildMonthly:   viper.GetInt("QUOTA_GUILD_MONTHLY_TOKENS"),
+		DowngradeModel: viper.GetString("QUOTA_DOWNGRADE_MODEL"),
+	}
+
+	config.Prices = make(map[string]ModelPrice)
+	if prices := viper.GetString("MODEL_PRICES"); prices != "" {
+		if err := json.Unmarshal([]byte(prices), &config.Prices); err != nil {
+			zap.L().Fatal("invalid MODEL_PRICES", zap.Error(err))
+		}
+	}
+
+	config.Reasoning = ReasoningConfig{
+		Display:             viper.GetString("REASONING_DISPLAY"),
+		ImplicitThinkModels: splitList(viper.GetString("REASONING_IMPLICIT_THINK_MODELS")),
+	}
+
+	if len(config.Reasoning.ImplicitThinkModels) == 0 {
+		config.Reasoning.ImplicitThinkModels = []string{"deepseek-r1", "qwq"}
+	}
+
+	switch config.Reasoning.Display {
+	case "":
+		config.Reasoning.Display = "hidden"
+	case "hidden", "status", "spoiler":
+	default:
+		zap.L().Fatal("invalid REASONING_DISPLAY", zap.String("display", config.Reasoning.Display))
+	}
+
+	config.Cache = CacheConfig{
+		Enabled:          viper.GetBool("CACHE_ENABLED"),
+		TTL:              viper.GetDuration("CACHE_TTL"),
+		DisabledChannels: splitList(viper.GetString("CACHE_DISABLED_CHANNELS")),
+		LinkSummaries:    viper.GetBool("CACHE_LINK_SUMMARIES"),
+	}
+
+	if config.Cache.TTL <= 0 {
+		config.Cache.TTL = 24 * time.Hour
+	}
+
+	config.Embeddings = EmbeddingsConfig{
+		Provider:      viper.GetString("EMBEDDINGS_PROVIDER"),
+		Endpoint:      viper.GetString("EMBEDDINGS_ENDPOINT"),
+		ApiKey:        viper.GetString("EMBEDDINGS_API_KEY"),
+		Model:         viper.GetString("EMBEDDINGS_MODEL"),
+		TopK:          viper.GetInt("RETRIEVAL_TOP_K"),
+		MinSimilarity: viper.GetFloat64("RETRIEVAL_MIN_SIMILARITY"),
+	}
+
+	if config.Embeddings.Provider != "" && config.Embeddings.Model == "" {
+		zap.L().Fatal("EMBEDDINGS_MODEL is required for retrieval")
+	}
+
+	if config.Embeddings.TopK <= 0 {
+		config.Embeddings.TopK = 5
+	}
+
+	config.Transcription = TranscriptionConfig{
+		Endpoint: viper.GetString("TRANSCRIPTION_ENDPOINT"),
+		ApiKey:   viper.GetString("TRANSCRIPTION_API_KEY"),
+		Model:    viper.GetString("TRANSCRIPTION_MODEL"),
+		Language: viper.GetString("TRANSCRIPTION_LANGUAGE"),
+		MaxBytes: viper.GetInt("TRANSCRIPTION_MAX_BYTES"),
+	}
+
+	if config.Transcription.Model == "" {
+		config.Transcription.Model = "whisper-1"
+	}
+
+	if config.Transcription.MaxBytes <= 0 {
+		config.Transcription.MaxBytes = 25 * 1024 * 1024
+	}
+
+	config.Speech = SpeechConfig{
+		Endpoint: viper.GetString("SPEECH_ENDPOINT"),
+		ApiKey:   viper.GetString("SPEECH_API_KEY"),
+		Model:    viper.GetString("SPEECH_MODEL"),
+		Voice:    viper.GetString("SPEECH_VOICE"),
+		Format:   viper.GetString("SPEECH_FORMAT"),
+		Channels: splitList(viper.GetString("SPEECH_CHANNELS")),
+		MaxChars: viper.GetInt("SPEECH_MAX_CHARS"),
+	}
+
+	if voices := viper.GetString("SPEECH_VOICES"); voices != "" {
+		if err := json.Unmarshal([]byte(voices), &config.Speech.Voices); err != nil {
+			zap.L().Fatal("invalid SPEECH_VOICES", zap.Error(err))
+		}
+	}
+
+	if config.Speech.Model == "" {
+		config.Speech.Model = "tts-1"
+	}
+
+	if config.Speech.Voice == "" {
+		config.Speech.Voice = "alloy"
+	}
+
+	if config.Speech.Format == "" {
+		config.Speech.Format = "mp3"
+	}
+
+	if config.Speech.MaxChars <= 0 {
+		config.Speech.MaxChars = 4096
+	}
+
+	config.Images = ImagesConfig{
+		Size:           viper.GetString("IMAGE_SIZE"),
+		ResponseFormat: viper.GetString("IMAGE_RESPONSE_FORMAT"),
+		RewritePrompt:  viper.GetBool("IMAGE_REWRITE_PROMPT"),
+		Seed:           viper.GetBool("IMAGE_SEED"),
+		EditMode:       viper.GetString("IMAGE_EDIT_MODE"),
+		EditEndpoint:   viper.GetString("OPENAI_IMG_EDIT_ENDPOINT"),
+		EditModel:      viper.GetString("IMAGE_EDIT_MODEL"),
+	}
+
+	switch config.Images.EditMode {
+	case "", "img2img":
+	case "edits":
+		if config.Images.EditEndpoint == "" {
+			config.Images.EditEndpoint = strings.Replace(viper.GetString("OPENAI_IMG_ENDPOINT"), "/images/generations", "/images/edits", 1)
+		}
+	default:
+		zap.L().Fatal("invalid IMAGE_EDIT_MODE", zap.String("mode", config.Images.EditMode))
+	}
+
+	switch config.Images.ResponseFormat {
+	case "", "b64_json", "url":
+	default:
+		zap.L().Fatal("invalid IMAGE_RESPONSE_FORMAT", zap.String("format", config.Images.ResponseFormat))
+	}
+
+	config.Moderation = ModerationConfig{
+		Provider:   viper.GetString("MODERATION_PROVIDER"),
+		Endpoint:   viper.GetString("MODERATION_ENDPOINT"),
+		ApiKey:     viper.GetString("MODERATION_API_KEY"),
+		Model:      viper.GetString("MODERATION_MODEL"),
+		Categories: splitList(viper.GetString("MODERATION_CATEGORIES")),
+	}
+
+	switch config.Moderation.Provider {
+	case "", "openai", "llm":
+	default:
+		zap.L().Fatal("invalid MODERATION_PROVIDER", zap.String("provider", config.Moderation.Provider))
+	}
+
+	if policies := viper.GetString("MODERATION_POLICIES"); policies != "" {
+		if err := json.Unmarshal([]byte(policies), &config.Moderation.Policies); err != nil {
+			zap.L().Fatal("invalid MODERATION_POLICIES", zap.Error(err))
+		}
+	}
+
+	for guild, policy := range config.Moderation.Policies {
+		for category, action := range policy.Actions {
+			switch action {
+			case "allow", "log", "spoiler", "refuse":
+			default:
+				zap.L().Fatal("invalid moderation action", zap.String("guild", guild), zap.String("category", category), zap.String("action", action))
+			}
+		}
+	}
+
+	config.Fallback = FallbackConfig{
+		Name:             viper.GetString("FALLBACK_NAME"),
+		FailureThreshold: viper.GetInt("FALLBACK_FAILURE_THRESHOLD"),
+		ProbeInterval:    viper.GetDuration("FALLBACK_PROBE_INTERVAL"),
+	}
+
+	if targets := viper.GetString("FALLBACK_TARGETS"); targets != "" {
+		if err := json.Unmarshal([]byte(targets), &config.Fallback.Targets); err != nil {
+			zap.L().Fatal("invalid FALLBACK_TARGETS", zap.Error(err))
+		}
+	}
+
+	for _, target := range config.Fallback.Targets {
+		_, named := config.Providers[target.Provider]
+		if _, ok := ParseProvider(target.Provider); !ok && !named {
+			zap.L().Fatal("unknown fallback target provider", zap.String("provider", target.Provider))
+		}
+	}
+
+	if config.Fallback.Name == "" {
+		config.Fallback.Name = "fallback"
+	}
+
+	if config.Fallback.FailureThreshold <= 0 {
+		config.Fallback.FailureThreshold = 3
+	}
+
+	if config.Fallback.ProbeInterval <= 0 {
+		config.Fallback.ProbeInterval = time.Minute
+	}
+
 	config.Database = DatabaseConfig{
 		Path: viper.GetString("DB_PATH"),
 	}
@@ -137,6 +688,21 @@ func Init() {
 		zap.L().Fatal("model name is required")
 	}
 
+	// LLM_PROVIDER names one of PROVIDERS, the fallback chain, or the kind of the single provider configured the old way
+	providerName := viper.GetString("LLM_PROVIDER")
+	if _, ok := config.Providers[providerName]; ok {
+		config.DefaultProvider = providerName
+	} else if len(config.Fallback.Targets) > 0 && providerName == config.Fallback.Name {
+		config.DefaultProvider = providerName
+	} else {
+		if _, ok := ParseProvider(providerName); !ok {
+			providerName = "openai"
+		}
+
+		config.DefaultProvider = "default"
+		config.Providers["default"] = ProviderConfig{Kind: providerName, Model: config.Model}
+	}
+
 	if config.Discord.BotId == "" || config.Discord.Token == "" {
 		zap.L().Fatal("invalid discord config")
 	}
@@ -144,6 +710,34 @@ func Init() {
 	zap.L().Debug("config loaded")
 }
 
+// ParseProvider maps a provider name from the config to its LLMProvider
+func ParseProvider(name string) (LLMProvider, bool) {
+	switch name {
+	case "openai":
+		return OpenAI, true
+	case "anthropic":
+		return Anthropic, true
+	case "ollama":
+		return Ollama, true
+	case "gemini":
+		return Gemini, true
+	default:
+		return OpenAI, false
+	}
+}
+
+// splitList parses a comma separated list, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+
+	return list
+}
+
 func InitLogger() {
 	zapConfig := zap.Config{
 		Level:            zap.NewAtomicLevelAt(Data.LogLevel),
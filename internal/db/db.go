@@ -3,10 +3,13 @@ package db
 import (
 	"database/sql"
 	"discord-military-analyst-bot/internal/llm"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -30,6 +33,19 @@ type Message struct {
 	CreatedAt    time.Time
 }
 
+// Usage is the token usage of a single reply
+type Usage struct {
+	MessageID        string
+	UserID           string
+	ChannelID        string
+	GuildID          string // empty for DMs
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64 // estimated, in USD
+	Estimated        bool    // true if the token counts were estimated because the provider didn't report them
+}
+
 // New creates a new MessageDB instance
 func New(dbPath string) (*MessageDB, error) {
 	if dbPath == "" {
@@ -55,21 +71,130 @@ func New(dbPath string) (*MessageDB, error) {
 		);
 		CREATE INDEX IF NOT EXISTS idx_messages_channel_id ON messages(channel_id);
 		CREATE INDEX IF NOT EXISTS idx_messages_referenced_id ON messages(referenced_id);
+		CREATE TABLE IF NOT EXISTS usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			guild_id TEXT NOT NULL,
+			model TEXT NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			cost REAL NOT NULL,
+			estimated BOOLEAN NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_usage_user_id ON usage(user_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_usage_guild_id ON usage(guild_id, created_at);
+		CREATE TABLE IF NOT EXISTS response_cache (
+			key TEXT PRIMARY KEY,
+			response TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_response_cache_created_at ON response_cache(created_at);
+		CREATE TABLE IF NOT EXISTS page_cache (
+			url TEXT PRIMARY KEY,
+			content TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_page_cache_created_at ON page_cache(created_at);
+		CREATE TABLE IF NOT EXISTS summaries (
+			url TEXT NOT NULL,
+			guild_id TEXT NOT NULL,
+			channel_id TEXT NOT NULL,
+			message_id TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_summaries_url ON summaries(url, guild_id, created_at);
+		CREATE TABLE IF NOT EXISTS message_embeddings (
+			message_id TEXT PRIMARY KEY,
+			channel_id TEXT NOT NULL,
+			model TEXT NOT NULL,
+			vector BLOB NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_message_embeddings_channel_id ON message_embeddings(channel_id, model, created_at);
+		CREATE TABLE IF NOT EXISTS suspicious_pages (
+			url TEXT NOT NULL,
+			conversation_id TEXT NOT NULL,
+			phrases TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_suspicious_pages_url ON suspicious_pages(url, created_at);
+		CREATE TABLE IF NOT EXISTS transcripts (
+			attachment_id TEXT PRIMARY KEY,
+			message_id TEXT NOT NULL,
+			transcript TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_transcripts_message_id ON transcripts(message_id);
+		CREATE TABLE IF NOT EXISTS image_generations (
+			message_id TEXT PRIMARY KEY,
+			prompt TEXT NOT NULL,
+			model TEXT NOT NULL,
+			size TEXT,
+			seed INTEGER,
+			source_url TEXT,
+			created_at TIMESTAMP NOT NULL
+		);
 	`)
 	if err != nil {
 		db.Close()
 		return nil, err
 	}
 
+	// Columns added after the initial schema
+	err = addColumnIfMissing(db, "messages", "served_by", "TEXT")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = addColumnIfMissing(db, "messages", "reasoning", "TEXT")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &MessageDB{db: db}, nil
 }
 
+// addColumnIfMissing adds a column to an existing table, since CREATE TABLE IF NOT EXISTS leaves old tables as they are
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return err
+		}
+
+		if name == column {
+			return nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 // Close closes the database connection
 func (m *MessageDB) Close() error {
 	return m.db.Close()
 }
 
-// SaveMessage saves a message to the database
+// SaveMessage saves a message to the database. Saving it again updates its content but keeps its creation time and the
+// metadata recorded with SetServedBy and SetReasoning.
 func (m *MessageDB) SaveMessage(msg *discordgo.Message, isBotMessage bool) error {
 	attachmentsJSON, err := json.Marshal(msg.Attachments)
 	if err != nil {
@@ -82,9 +207,14 @@ func (m *MessageDB) SaveMessage(msg *discordgo.Message, isBotMessage bool) error
 	}
 
 	_, err = m.db.Exec(
-		`INSERT OR REPLACE INTO messages 
+		`INSERT INTO messages 
 		(id, channel_id, author_id, content, is_bot_message, attachments, referenced_id, created_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			content = excluded.content,
+			is_bot_message = excluded.is_bot_message,
+			attachments = excluded.attachments,
+			referenced_id = excluded.referenced_id`,
 		msg.ID,
 		msg.ChannelID,
 		msg.Author.ID,
@@ -97,6 +227,341 @@ func (m *MessageDB) SaveMessage(msg *discordgo.Message, isBotMessage bool) error
 	return err
 }
 
+// SetServedBy records which provider target generated a bot message
+func (m *MessageDB) SetServedBy(messageID string, servedBy string) error {
+	_, err := m.db.Exec(`UPDATE messages SET served_by = ? WHERE id = ?`, servedBy, messageID)
+	return err
+}
+
+// SetReasoning stores the thinking of a reasoning model that was kept out of a bot message
+func (m *MessageDB) SetReasoning(messageID string, reasoning string) error {
+	_, err := m.db.Exec(`UPDATE messages SET reasoning = ? WHERE id = ?`, reasoning, messageID)
+	return err
+}
+
+// SaveUsage records the token usage of a reply
+func (m *MessageDB) SaveUsage(usage Usage) error {
+	_, err := m.db.Exec(
+		`INSERT INTO usage
+		(message_id, user_id, channel_id, guild_id, model, prompt_tokens, completion_tokens, cost, estimated, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		usage.MessageID,
+		usage.UserID,
+		usage.ChannelID,
+		usage.GuildID,
+		usage.Model,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		usage.Cost,
+		usage.Estimated,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// GetUserTokens returns the tokens used by replies to a user since the given time
+func (m *MessageDB) GetUserTokens(userID string, since time.Time) (int, error) {
+	return m.tokensSince("user_id", userID, since)
+}
+
+// GetGuildTokens returns the tokens used by replies in a guild since the given time
+func (m *MessageDB) GetGuildTokens(guildID string, since time.Time) (int, error) {
+	return m.tokensSince("guild_id", guildID, since)
+}
+
+// tokensSince sums the usage rows of a user or guild. Times are stored in UTC, since SQLite compares them as strings.
+func (m *MessageDB) tokensSince(column string, id string, since time.Time) (int, error) {
+	var tokens int
+	err := m.db.QueryRow(
+		fmt.Sprintf(`SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0) FROM usage WHERE %s = ? AND created_at >= ?`, column),
+		id,
+		since.UTC(),
+	).Scan(&tokens)
+	return tokens, err
+}
+
+// GetCachedResponse returns the cached response for the key if it was stored after notBefore
+func (m *MessageDB) GetCachedResponse(key string, notBefore time.Time) (string, bool, error) {
+	var response string
+	err := m.db.QueryRow(
+		`SELECT response FROM response_cache WHERE key = ? AND created_at >= ?`,
+		key,
+		notBefore.UTC(),
+	).Scan(&response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return response, true, nil
+}
+
+// SaveCachedResponse stores a response under the key, replacing an older one
+func (m *MessageDB) SaveCachedResponse(key string, response string) error {
+	_, err := m.db.Exec(
+		`INSERT OR REPLACE INTO response_cache (key, response, created_at) VALUES (?, ?, ?)`,
+		key,
+		response,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// DeleteCachedResponses removes the cached responses stored before the given time
+func (m *MessageDB) DeleteCachedResponses(before time.Time) error {
+	_, err := m.db.Exec(`DELETE FROM response_cache WHERE created_at < ?`, before.UTC())
+	return err
+}
+
+// GetCachedPage returns the extracted content of the page if it was stored after notBefore
+func (m *MessageDB) GetCachedPage(url string, notBefore time.Time) (string, bool, error) {
+	var content string
+	err := m.db.QueryRow(
+		`SELECT content FROM page_cache WHERE url = ? AND created_at >= ?`,
+		url,
+		notBefore.UTC(),
+	).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return content, true, nil
+}
+
+// SaveCachedPage stores the extracted content of a page, replacing an older one
+func (m *MessageDB) SaveCachedPage(url string, content string) error {
+	_, err := m.db.Exec(
+		`INSERT OR REPLACE INTO page_cache (url, content, created_at) VALUES (?, ?, ?)`,
+		url,
+		content,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// DeleteCachedPages removes the pages stored before the given time
+func (m *MessageDB) DeleteCachedPages(before time.Time) error {
+	_, err := m.db.Exec(`DELETE FROM page_cache WHERE created_at < ?`, before.UTC())
+	return err
+}
+
+// Summary is a bot reply that summarized a link
+type Summary struct {
+	GuildID   string
+	ChannelID string
+	MessageID string
+}
+
+// SaveSummary records the reply that summarized a link
+func (m *MessageDB) SaveSummary(url string, summary Summary) error {
+	_, err := m.db.Exec(
+		`INSERT INTO summaries (url, guild_id, channel_id, message_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+		url,
+		summary.GuildID,
+		summary.ChannelID,
+		summary.MessageID,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// GetSummary returns the latest summary of a link in the guild made after notBefore
+func (m *MessageDB) GetSummary(url string, guildID string, notBefore time.Time) (*Summary, error) {
+	summary := Summary{GuildID: guildID}
+	err := m.db.QueryRow(
+		`SELECT channel_id, message_id FROM summaries
+		WHERE url = ? AND guild_id = ? AND created_at >= ?
+		ORDER BY created_at DESC LIMIT 1`,
+		url,
+		guildID,
+		notBefore.UTC(),
+	).Scan(&summary.ChannelID, &summary.MessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// SaveSuspiciousPage records a fetched page that contained text that looked like instructions to the model
+func (m *MessageDB) SaveSuspiciousPage(url string, conversationID string, phrases []string) error {
+	_, err := m.db.Exec(
+		`INSERT INTO suspicious_pages (url, conversation_id, phrases, created_at) VALUES (?, ?, ?, ?)`,
+		url,
+		conversationID,
+		strings.Join(phrases, "\n"),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// EmbeddedMessage is a stored message together with its embedding
+type EmbeddedMessage struct {
+	ID     string
+	Item   llm.HistoryItem
+	Vector []float32
+}
+
+// SaveEmbedding stores the embedding of a message, replacing an earlier one
+func (m *MessageDB) SaveEmbedding(messageID string, channelID string, model string, vector []float32) error {
+	_, err := m.db.Exec(
+		`INSERT OR REPLACE INTO message_embeddings (message_id, channel_id, model, vector, created_at) VALUES (?, ?, ?, ?, ?)`,
+		messageID,
+		channelID,
+		model,
+		encodeVector(vector),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// GetEmbeddedMessages returns the latest messages of the channel embedded with the model, newest first
+func (m *MessageDB) GetEmbeddedMessages(channelID string, model string, limit int) ([]EmbeddedMessage, error) {
+	rows, err := m.db.Query(
+		`SELECT m.id, m.content, m.is_bot_message, m.attachments, m.created_at, e.vector
+		FROM message_embeddings e JOIN messages m ON m.id = e.message_id
+		WHERE e.channel_id = ? AND e.model = ?
+		ORDER BY m.created_at DESC LIMIT ?`,
+		channelID,
+		model,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []EmbeddedMessage
+	for rows.Next() {
+		var message EmbeddedMessage
+		var attachmentsJSON string
+		var vector []byte
+
+		err := rows.Scan(&message.ID, &message.Item.Content, &message.Item.IsBotMessage, &attachmentsJSON, &message.Item.CreatedAt, &vector)
+		if err != nil {
+			return nil, err
+		}
+
+		if attachmentsJSON != "" {
+			if err := json.Unmarshal([]byte(attachmentsJSON), &message.Item.Attachments); err != nil {
+				zap.L().Error("failed to unmarshal attachments", zap.Error(err))
+			}
+		}
+
+		message.Item.ID = message.ID
+		message.Vector = decodeVector(vector)
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// encodeVector packs the vector as little-endian float32s
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+
+	return vector
+}
+
+// SaveTranscript stores the transcript of an audio attachment of a message
+func (m *MessageDB) SaveTranscript(messageID string, attachmentID string, transcript string) error {
+	_, err := m.db.Exec(
+		`INSERT OR REPLACE INTO transcripts (attachment_id, message_id, transcript, created_at) VALUES (?, ?, ?, ?)`,
+		attachmentID,
+		messageID,
+		transcript,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// GetTranscript returns the stored transcript of an audio attachment, if there is one
+func (m *MessageDB) GetTranscript(attachmentID string) (string, bool, error) {
+	var transcript string
+	err := m.db.QueryRow(`SELECT transcript FROM transcripts WHERE attachment_id = ?`, attachmentID).Scan(&transcript)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return transcript, true, nil
+}
+
+// ImageGeneration holds the parameters a generated image was made with
+type ImageGeneration struct {
+	MessageID string // the bot message the image was attached to
+	Prompt    string
+	Model     string
+	Size      string
+	Seed      *int
+	SourceURL string // the edited image, empty if the image was generated from text
+}
+
+// SaveImageGeneration stores the parameters of a generated image
+func (m *MessageDB) SaveImageGeneration(generation ImageGeneration) error {
+	_, err := m.db.Exec(
+		`INSERT OR REPLACE INTO image_generations (message_id, prompt, model, size, seed, source_url, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		generation.MessageID,
+		generation.Prompt,
+		generation.Model,
+		generation.Size,
+		generation.Seed,
+		generation.SourceURL,
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// GetImageGeneration returns the parameters of the image attached to a bot message, or nil if it has none
+func (m *MessageDB) GetImageGeneration(messageID string) (*ImageGeneration, error) {
+	generation := ImageGeneration{MessageID: messageID}
+	var size, sourceURL sql.NullString
+	var seed sql.NullInt64
+
+	err := m.db.QueryRow(
+		`SELECT prompt, model, size, seed, source_url FROM image_generations WHERE message_id = ?`,
+		messageID,
+	).Scan(&generation.Prompt, &generation.Model, &size, &seed, &sourceURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	generation.Size = size.String
+	generation.SourceURL = sourceURL.String
+	if seed.Valid {
+		value := int(seed.Int64)
+		generation.Seed = &value
+	}
+
+	return &generation, nil
+}
+
 // GetMessage retrieves a message from the database by ID
 func (m *MessageDB) GetMessage(id string) (*Message, error) {
 	var msg Message
@@ -149,9 +614,11 @@ func (m *MessageDB) GetMessageHistory(messageID string, botID string) ([]llm.His
 		}
 
 		history = append([]llm.HistoryItem{{
+			ID:           msg.ID,
 			IsBotMessage: msg.IsBotMessage,
 			Content:      msg.Content,
 			Attachments:  attachments,
+			CreatedAt:    msg.CreatedAt,
 		}}, history...)
 
 		currentID = msg.ReferencedID
@@ -183,7 +650,7 @@ func (m *MessageDB) GetAllRelatedMessages(messageID string, botID string) ([]llm
 
 	// Get recent messages from the same channel (limited to last 50)
 	rows, err := m.db.Query(
-		`SELECT id, content, is_bot_message, attachments 
+		`SELECT id, content, is_bot_message, attachments, created_at 
 		FROM messages 
 		WHERE channel_id = ? 
 		ORDER BY created_at DESC LIMIT 50`,
@@ -207,8 +674,9 @@ func (m *MessageDB) GetAllRelatedMessages(messageID string, botID string) ([]llm
 		var id, content string
 		var isBotMessage bool
 		var attachmentsJSON string
+		var createdAt time.Time
 
-		if err := rows.Scan(&id, &content, &isBotMessage, &attachmentsJSON); err != nil {
+		if err := rows.Scan(&id, &content, &isBotMessage, &attachmentsJSON, &createdAt); err != nil {
 			continue
 		}
 
@@ -226,12 +694,34 @@ func (m *MessageDB) GetAllRelatedMessages(messageID string, botID string) ([]llm
 		}
 
 		additionalHistory = append(additionalHistory, llm.HistoryItem{
+			ID:           id,
 			IsBotMessage: isBotMessage,
 			Content:      content,
 			Attachments:  attachments,
+			CreatedAt:    createdAt,
 		})
 	}
 
 	// Combine the histories, with direct reply chain first
 	return append(history, additionalHistory...), nil
 }
+
+// GetConversationRoot follows the reply chain of a message up to the first message of the conversation
+func (m *MessageDB) GetConversationRoot(messageID string) string {
+	rootID := messageID
+	visited := make(map[string]bool)
+
+	for currentID := messageID; currentID != "" && !visited[currentID]; {
+		visited[currentID] = true
+
+		msg, err := m.GetMessage(currentID)
+		if err != nil {
+			break
+		}
+
+		rootID = msg.ID
+		currentID = msg.ReferencedID
+	}
+
+	return rootID
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func newTestDB(t *testing.T) *MessageDB {
+	t.Helper()
+
+	messageDB, err := New(filepath.Join(t.TempDir(), "messages.db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { _ = messageDB.Close() })
+
+	return messageDB
+}
+
+func TestSaveMessageKeepsMetadata(t *testing.T) {
+	messageDB := newTestDB(t)
+	message := &discordgo.Message{ID: "1", ChannelID: "10", Author: &discordgo.User{ID: "bot"}, Content: "Thinking…"}
+
+	if err := messageDB.SaveMessage(message, true); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+	if err := messageDB.SetServedBy(message.ID, "openai/gpt-4o"); err != nil {
+		t.Fatalf("SetServedBy: %v", err)
+	}
+	if err := messageDB.SetReasoning(message.ID, "The user asks about armor."); err != nil {
+		t.Fatalf("SetReasoning: %v", err)
+	}
+
+	// Saved again when someone replies to it
+	message.Content = "Final answer"
+	if err := messageDB.SaveMessage(message, true); err != nil {
+		t.Fatalf("SaveMessage again: %v", err)
+	}
+
+	var content string
+	var servedBy, reasoning sql.NullString
+	err := messageDB.db.QueryRow(`SELECT content, served_by, reasoning FROM messages WHERE id = ?`, message.ID).
+		Scan(&content, &servedBy, &reasoning)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	if content != "Final answer" {
+		t.Errorf("content = %q, want the updated content", content)
+	}
+	if servedBy.String != "openai/gpt-4o" {
+		t.Errorf("served_by = %q, want it kept", servedBy.String)
+	}
+	if reasoning.String != "The user asks about armor." {
+		t.Errorf("reasoning = %q, want it kept", reasoning.String)
+	}
+}
@@ -0,0 +1,340 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultAnthropicEndpoint  = "https://api.anthropic.com/v1/messages"
+	DefaultAnthropicVersion   = "2023-06-01"
+	DefaultAnthropicMaxTokens = 1024
+)
+
+type AnthropicClient struct {
+	Endpoint    string
+	Token       string
+	Version     string
+	MaxTokens   int
+	Temperature float64
+}
+
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   float64            `json:"temperature"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Metadata      *anthropicMetadata `json:"metadata,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicResponse struct {
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+// AnthropicStreamEvent is the payload of a single SSE "data:" line
+type AnthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"` // message_start
+	Usage anthropicUsage `json:"usage"` // message_delta, with the cumulative output tokens
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewAnthropicClient(endpoint string, token string, version string, maxTokens int, temperature float64) *AnthropicClient {
+	if endpoint == "" {
+		endpoint = DefaultAnthropicEndpoint
+	}
+
+	if version == "" {
+		version = DefaultAnthropicVersion
+	}
+
+	if maxTokens <= 0 {
+		maxTokens = DefaultAnthropicMaxTokens
+	}
+
+	provider := &AnthropicClient{
+		Endpoint:    endpoint,
+		Token:       token,
+		Version:     version,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+
+	return provider
+}
+
+// buildMessages converts the history into Anthropic messages, merging consecutive turns of the same role
+// since the API expects user and assistant turns to alternate. The first turn must be the user's, so leading
+// bot messages (e.g. from retrieved history) are dropped.
+func (c *AnthropicClient) buildMessages(message string, history []HistoryItem) []anthropicMessage {
+	messages := make([]anthropicMessage, 0)
+
+	appendTurn := func(role string, text string) {
+		block := anthropicContentBlock{Type: "text", Text: text}
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, block)
+			return
+		}
+
+		messages = append(messages, anthropicMessage{Role: role, Content: []anthropicContentBlock{block}})
+	}
+
+	for _, item := range history {
+		if item.Content == "" {
+			continue
+		}
+
+		role := "user"
+		if item.IsBotMessage {
+			role = "assistant"
+		}
+
+		if role == "assistant" && len(messages) == 0 {
+			continue
+		}
+
+		appendTurn(role, item.Content)
+	}
+
+	appendTurn("user", message)
+	return messages
+}
+
+func (c *AnthropicClient) newRequest(ctx context.Context, request Request, stream bool) (*http.Request, error) {
+	requestBody := anthropicRequest{
+		Model:         request.Model,
+		System:        request.System,
+		Messages:      c.buildMessages(request.Message, request.History),
+		MaxTokens:     c.MaxTokens,
+		Temperature:   request.temperature(c.Temperature),
+		TopP:          request.TopP,
+		StopSequences: request.Stop,
+		Stream:        stream,
+	}
+
+	if request.MaxTokens > 0 {
+		requestBody.MaxTokens = request.MaxTokens
+	}
+
+	if request.User != "" {
+		requestBody.Metadata = &anthropicMetadata{UserID: request.User}
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	zap.L().Debug("anthropic request", zap.Bool("stream", stream), zap.String("body", string(jsonBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-api-key", c.Token)
+	req.Header.Set("anthropic-version", c.Version)
+	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	} else {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	return req, nil
+}
+
+// anthropicError classifies a failed response like the other providers, keeping only the type and message of an
+// Anthropic error body
+func anthropicError(resp *http.Response, body []byte) error {
+	apiErr := newAPIError(resp, body)
+	var errResp anthropicErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		apiErr.Body = errResp.Error.Type + ": " + errResp.Error.Message
+	}
+
+	return apiErr
+}
+
+func (c *AnthropicClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	req, err := c.newRequest(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 180 * time.Second}
+
+	go func() {
+		defer close(responseChan)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			zap.L().Error("anthropic stream request failed", zap.Error(err))
+			responseChan <- StreamResponse{Error: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			responseChan <- StreamResponse{Error: anthropicError(resp, body)}
+			return
+		}
+
+		// The input tokens come with message_start, the final output count with the last message_delta
+		var usage Usage
+		defer func() { recordUsage(ctx, usage) }()
+
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				responseChan <- StreamResponse{Error: err}
+				return
+			}
+
+			// Event names are repeated in the data payload, so only "data:" lines are relevant
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var event AnthropicStreamEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				zap.L().Error("failed to unmarshal anthropic stream event", zap.Error(err), zap.String("data", data))
+				continue
+			}
+
+			switch event.Type {
+			case "message_start":
+				usage.PromptTokens = event.Message.Usage.InputTokens
+				usage.CompletionTokens = event.Message.Usage.OutputTokens
+			case "message_delta":
+				usage.CompletionTokens = max(usage.CompletionTokens, event.Usage.OutputTokens)
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" {
+					responseChan <- StreamResponse{Content: event.Delta.Text, Done: false}
+				}
+			case "message_stop":
+				responseChan <- StreamResponse{Done: true}
+				return
+			case "error":
+				errMessage := "unknown anthropic stream error"
+				if event.Error != nil {
+					errMessage = event.Error.Type + ": " + event.Error.Message
+				}
+				responseChan <- StreamResponse{Error: errors.New(errMessage)}
+				return
+			}
+		}
+
+		responseChan <- StreamResponse{Done: true}
+	}()
+
+	return responseChan, nil
+}
+
+func (c *AnthropicClient) Infer(ctx context.Context, request Request) (string, error) {
+	req, err := c.newRequest(ctx, request, false)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 180 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		zap.L().Error("anthropic request failed", zap.Error(err))
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", anthropicError(resp, body)
+	}
+
+	var result AnthropicResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	recordUsage(ctx, Usage{PromptTokens: result.Usage.InputTokens, CompletionTokens: result.Usage.OutputTokens})
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	return text.String(), nil
+}
+
+// InferWithStream is a convenience method that collects all streaming chunks into a single response
+func (c *AnthropicClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	stream, err := c.InferStream(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	response, _, err := collectStream(ctx, stream, callback)
+	return response, err
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+// anthropicEvent formats an Anthropic SSE event, which repeats the type in the event line
+func anthropicEvent(v map[string]any) string {
+	return "event: " + v["type"].(string) + "\n" + llmtest.Event(v)
+}
+
+func anthropicTextDelta(text string) string {
+	return anthropicEvent(map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": text},
+	})
+}
+
+func TestAnthropicStream(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: llmtest.Split(16,
+		anthropicEvent(map[string]any{"type": "message_start", "message": map[string]any{"id": "msg_1", "usage": map[string]any{"input_tokens": 12, "output_tokens": 1}}}),
+		anthropicEvent(map[string]any{"type": "content_block_start", "index": 0, "content_block": map[string]any{"type": "text", "text": ""}}),
+		"event: ping\ndata: {\"type\": \"ping\"}\n\n",
+		anthropicTextDelta("Hello"),
+		anthropicTextDelta(", world"),
+		anthropicEvent(map[string]any{"type": "content_block_stop", "index": 0}),
+		anthropicEvent(map[string]any{"type": "message_delta", "delta": map[string]any{"stop_reason": "end_turn"}, "usage": map[string]any{"output_tokens": 5}}),
+		anthropicEvent(map[string]any{"type": "message_stop"}),
+		anthropicTextDelta(" after stop"),
+	)})
+	client := NewAnthropicClient(server.URL+"/v1/messages", "test-token", "", 0, 0.7)
+
+	ctx, info := WithResponseInfo(context.Background())
+	response, err := client.InferWithStream(ctx, testRequest(), nil)
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+
+	if response != "Hello, world" {
+		t.Errorf("response = %q, want %q", response, "Hello, world")
+	}
+
+	if info.Usage.PromptTokens != 12 || info.Usage.CompletionTokens != 5 {
+		t.Errorf("usage = %+v, want 12 prompt and 5 completion tokens", info.Usage)
+	}
+
+	request := server.LastRequest()
+	if request.Header.Get("x-api-key") != "test-token" || request.Header.Get("anthropic-version") != DefaultAnthropicVersion {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+	if request.Body["stream"] != true || request.Body["system"] != "You are a test." {
+		t.Errorf("unexpected request %s", request)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: []string{
+		anthropicTextDelta("Partial"),
+		anthropicEvent(map[string]any{"type": "error", "error": map[string]any{"type": "overloaded_error", "message": "Overloaded"}}),
+	}})
+	client := NewAnthropicClient(server.URL+"/v1/messages", "test-token", "", 0, 0.7)
+
+	_, err := client.InferWithStream(context.Background(), testRequest(), nil)
+	if err == nil || !strings.Contains(err.Error(), "overloaded_error: Overloaded") {
+		t.Errorf("error = %v, want the stream error", err)
+	}
+}
+
+func TestAnthropicMessages(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"content":     []map[string]any{{"type": "text", "text": "Fine"}},
+		"stop_reason": "end_turn",
+		"usage":       map[string]any{"input_tokens": 30, "output_tokens": 2},
+	}))
+	client := NewAnthropicClient(server.URL+"/v1/messages", "test-token", "", 0, 0.7)
+
+	request := testRequest()
+	request.History = []HistoryItem{
+		{Content: "Retrieved bot reply", IsBotMessage: true},
+		{Content: "Another bot reply", IsBotMessage: true},
+		{Content: "First question"},
+		{Content: "Second question"},
+		{Content: "Answer", IsBotMessage: true},
+	}
+
+	ctx, info := WithResponseInfo(context.Background())
+	if _, err := client.Infer(ctx, request); err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	if info.Usage.PromptTokens != 30 || info.Usage.CompletionTokens != 2 {
+		t.Errorf("usage = %+v, want 30 prompt and 2 completion tokens", info.Usage)
+	}
+
+	var body anthropicRequest
+	if err := server.LastRequest().Decode(&body); err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+
+	roles := make([]string, 0, len(body.Messages))
+	for _, message := range body.Messages {
+		roles = append(roles, message.Role)
+	}
+
+	got, _ := json.Marshal(roles)
+	if string(got) != `["user","assistant","user"]` {
+		t.Errorf("roles = %s, want the leading bot turns dropped and the rest alternating", got)
+	}
+	if len(body.Messages[0].Content) != 2 {
+		t.Errorf("consecutive user turns not merged: %+v", body.Messages[0])
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+		want     error
+		message  string
+	}{
+		{"overloaded", llmtest.Error(529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), ErrServer, "overloaded_error: Overloaded"},
+		{"context length", llmtest.Error(http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens"}}`), ErrContextLength, "prompt is too long"},
+		{"unauthorized", llmtest.Error(http.StatusUnauthorized, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`), ErrUnauthorized, "invalid x-api-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, tt.response, tt.response)
+			client := NewAnthropicClient(server.URL+"/v1/messages", "test-token", "", 0, 0.7)
+
+			_, err := client.Infer(context.Background(), testRequest())
+			_, streamErr := client.InferWithStream(context.Background(), testRequest(), nil)
+			for _, err := range []error{err, streamErr} {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("error = %v, want an APIError of kind %v with %q", err, tt.want, tt.message)
+				}
+			}
+		})
+	}
+}
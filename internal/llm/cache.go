@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ResponseStore persists cached responses
+type ResponseStore interface {
+	GetCachedResponse(key string, notBefore time.Time) (string, bool, error)
+	SaveCachedResponse(key string, response string) error
+	DeleteCachedResponses(before time.Time) error
+}
+
+// CachingClient answers repeated requests from a store instead of the wrapped client. Requests are keyed by the
+// model, the system prompt, the message with its whitespace normalized, the history and the sampling options. Tool calls and structured
+// calls are passed through, since their results depend on more than the request.
+type CachingClient struct {
+	Client Client
+	Store  ResponseStore
+	TTL    time.Duration
+}
+
+func NewCachingClient(client Client, store ResponseStore, ttl time.Duration) *CachingClient {
+	return &CachingClient{
+		Client: client,
+		Store:  store,
+		TTL:    ttl,
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache marks the requests made with the context to skip the cache
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// CacheDisabled reports whether the context was marked to skip the cache
+func CacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCacheKey{}).(bool)
+	return disabled
+}
+
+// cacheKey hashes everything that affects the response, except the user
+func cacheKey(request Request) string {
+	type historyEntry struct {
+		Bot         bool     `json:"bot"`
+		Content     string   `json:"content"`
+		Attachments []string `json:"attachments,omitempty"`
+	}
+
+	history := make([]historyEntry, 0, len(request.History))
+	for _, item := range request.History {
+		entry := historyEntry{Bot: item.IsBotMessage, Content: item.Content}
+		for _, attachment := range item.Attachments {
+			entry.Attachments = append(entry.Attachments, attachment.URL)
+		}
+
+		history = append(history, entry)
+	}
+
+	key, _ := json.Marshal(map[string]any{
+		"model":       request.Model,
+		"system":      request.System,
+		"message":     strings.Join(strings.Fields(request.Message), " "),
+		"history":     history,
+		"temperature": request.Temperature,
+		"top_p":       request.TopP,
+		"max_tokens":  request.MaxTokens,
+		"stop":        request.Stop,
+		"seed":        request.Seed,
+	})
+
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached response for the request, if there is a fresh one
+func (c *CachingClient) lookup(ctx context.Context, key string) (string, bool) {
+	if CacheDisabled(ctx) {
+		return "", false
+	}
+
+	response, ok, err := c.Store.GetCachedResponse(key, time.Now().Add(-c.TTL))
+	if err != nil {
+		zap.L().Error("failed to read response cache", zap.Error(err))
+		return "", false
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	zap.L().Debug("response cache hit", zap.String("key", key))
+	if info := responseInfoFromContext(ctx); info != nil {
+		info.ServedBy = "cache"
+		info.Cached = true
+	}
+
+	return response, true
+}
+
+func (c *CachingClient) save(ctx context.Context, key string, response string) {
+	if CacheDisabled(ctx) || strings.TrimSpace(response) == "" {
+		return
+	}
+
+	if err := c.Store.SaveCachedResponse(key, response); err != nil {
+		zap.L().Error("failed to save response to cache", zap.Error(err))
+	}
+
+	if err := c.Store.DeleteCachedResponses(time.Now().Add(-c.TTL)); err != nil {
+		zap.L().Error("failed to prune response cache", zap.Error(err))
+	}
+}
+
+func (c *CachingClient) Infer(ctx context.Context, request Request) (string, error) {
+	key := cacheKey(request)
+	if response, ok := c.lookup(ctx, key); ok {
+		return response, nil
+	}
+
+	response, err := c.Client.Infer(ctx, request)
+	if err == nil {
+		c.save(ctx, key, response)
+	}
+
+	return response, err
+}
+
+// InferWithStream replays a cached response as a single chunk
+func (c *CachingClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	key := cacheKey(request)
+	if response, ok := c.lookup(ctx, key); ok {
+		callback(response, false)
+		callback("", true)
+		return response, nil
+	}
+
+	response, err := inferStreamOrFallback(ctx, c.Client, request, callback)
+	if err == nil {
+		c.save(ctx, key, response)
+	}
+
+	return response, err
+}
+
+func (c *CachingClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	go func() {
+		defer close(responseChan)
+
+		_, err := c.InferWithStream(ctx, request, func(content string, done bool) {
+			responseChan <- StreamResponse{Content: content, Done: done}
+		})
+
+		if err != nil {
+			responseChan <- StreamResponse{Error: err}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+func (c *CachingClient) InferWithTools(ctx context.Context, request Request, steps []HistoryItem, tools []Tool, callback func(content string, done bool)) (string, []ToolCall, error) {
+	if toolClient, ok := c.Client.(ToolClient); ok {
+		return toolClient.InferWithTools(ctx, request, steps, tools, callback)
+	}
+
+	response, err := inferStreamOrFallback(ctx, c.Client, request, callback)
+	return response, nil, err
+}
+
+func (c *CachingClient) InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error) {
+	if structuredClient, ok := c.Client.(StructuredClient); ok {
+		return structuredClient.InferJSON(ctx, request, schema)
+	}
+
+	return "", ErrStructuredUnsupported
+}
+
+func (c *CachingClient) Capabilities(model string) Capabilities {
+	return CapabilitiesOf(c.Client, model)
+}
+
+// Unwrap returns the wrapped client
+func (c *CachingClient) Unwrap() Client {
+	return c.Client
+}
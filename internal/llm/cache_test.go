@@ -0,0 +1,25 @@
+package llm
+
+import "testing"
+
+func TestCacheKey(t *testing.T) {
+	base := testRequest()
+
+	spaced := base
+	spaced.Message = "  What   is\nup? "
+	if cacheKey(spaced) != cacheKey(base) {
+		t.Error("messages differing only in whitespace have different keys")
+	}
+
+	shouted := base
+	shouted.Message = "WHAT IS UP?"
+	if cacheKey(shouted) == cacheKey(base) {
+		t.Error("messages differing in case share a key")
+	}
+
+	otherModel := base
+	otherModel.Model = "other-model"
+	if cacheKey(otherModel) == cacheKey(base) {
+		t.Error("requests for different models share a key")
+	}
+}
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"slices"
+	"strings"
+)
+
+// Capabilities describes what a client can do for a model
+type Capabilities struct {
+	Streaming  bool
+	Tools      bool
+	Vision     bool // image attachments in the history are sent to the model
+	Structured bool // responses can be constrained to a JSON schema
+}
+
+// CapabilityReporter is implemented by clients whose capabilities aren't given by the interfaces they implement,
+// such as wrappers that implement every interface but depend on the clients they wrap
+type CapabilityReporter interface {
+	Capabilities(model string) Capabilities
+}
+
+// CapabilitiesOf returns what the client can do for the model
+func CapabilitiesOf(client Client, model string) Capabilities {
+	if reporter, ok := client.(CapabilityReporter); ok {
+		return reporter.Capabilities(model)
+	}
+
+	_, streaming := client.(StreamClient)
+	_, tools := client.(ToolClient)
+	_, structured := client.(StructuredClient)
+
+	return Capabilities{
+		Streaming:  streaming,
+		Tools:      tools,
+		Structured: structured,
+	}
+}
+
+func (c *OpenAIClient) Capabilities(model string) Capabilities {
+	return Capabilities{Streaming: true, Tools: true, Vision: visionModel(c.Vision, model), Structured: true}
+}
+
+// visionModel reports whether images should be sent to the model: vision has to be enabled, and if the settings list
+// models, the model has to match one of them
+func visionModel(vision config.VisionConfig, model string) bool {
+	if !vision.Enabled {
+		return false
+	}
+
+	if len(vision.Models) == 0 {
+		return true
+	}
+
+	model = strings.ToLower(model)
+	return slices.ContainsFunc(vision.Models, func(pattern string) bool {
+		return pattern != "" && strings.Contains(model, strings.ToLower(pattern))
+	})
+}
+
+// Capabilities of the provider the model resolves to
+func (r *Registry) Capabilities(model string) Capabilities {
+	_, client, resolved := r.Resolve(model)
+	if client == nil {
+		return Capabilities{}
+	}
+
+	return CapabilitiesOf(client, resolved)
+}
+
+// Capabilities common to all targets that may serve the request, since any of them can end up answering
+func (c *FallbackClient) Capabilities(model string) Capabilities {
+	candidates := c.candidates()
+	if len(candidates) == 0 {
+		return Capabilities{}
+	}
+
+	capabilities := CapabilitiesOf(candidates[0].client, candidates[0].modelFor(model))
+	for _, target := range candidates[1:] {
+		other := CapabilitiesOf(target.client, target.modelFor(model))
+		capabilities.Streaming = capabilities.Streaming && other.Streaming
+		capabilities.Tools = capabilities.Tools && other.Tools
+		capabilities.Vision = capabilities.Vision && other.Vision
+		capabilities.Structured = capabilities.Structured && other.Structured
+	}
+
+	return capabilities
+}
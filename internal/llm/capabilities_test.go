@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"discord-military-analyst-bot/internal/config"
+)
+
+func TestCapabilities(t *testing.T) {
+	openai := NewOpenAIClient("http://localhost", "", 0.7, testRetry)
+	if CapabilitiesOf(openai, "gpt-4o").Vision {
+		t.Error("vision reported although it is disabled")
+	}
+
+	// Set on the client, so differently configured clients can coexist
+	config.Data.Vision = config.VisionConfig{Enabled: true}
+	t.Cleanup(func() { config.Data.Vision = config.VisionConfig{} })
+	if CapabilitiesOf(openai, "gpt-4o").Vision {
+		t.Error("vision read from the global config instead of the client")
+	}
+
+	openai.Vision = config.VisionConfig{Enabled: true, Models: []string{"gpt-4o", "llava"}}
+	if !CapabilitiesOf(openai, "GPT-4o-mini").Vision || CapabilitiesOf(openai, "llama-3.1-70b").Vision {
+		t.Error("vision not limited to VISION_MODELS")
+	}
+
+	fallback := NewFallbackClient(3, time.Minute)
+	fallback.AddTarget("openai", openai, "")
+	fallback.AddTarget("anthropic", NewAnthropicClient("", "", "", 0, 0.7), "")
+
+	capabilities := CapabilitiesOf(fallback, "gpt-4o")
+	if capabilities.Vision || capabilities.Tools || capabilities.Structured || !capabilities.Streaming {
+		t.Errorf("fallback capabilities = %+v, want only what both targets support", capabilities)
+	}
+}
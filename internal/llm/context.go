@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"sort"
+)
+
+// messageOverhead approximates the tokens a chat template spends on role markers and separators per message
+const messageOverhead = 4
+
+// imageTokens approximates the tokens a vision model spends on an attached image
+const imageTokens = 800
+
+// ContextBudget describes how much of a model's context window a request may use
+type ContextBudget struct {
+	Window          int // total context window of the model in tokens, no limit if zero
+	ResponseReserve int // tokens kept free for the response
+	Estimator       TokenEstimator
+	Vision          config.VisionConfig // limits of the images that are sent, which count towards the window
+}
+
+// ContextReport describes what had to be cut to fit a request into the budget
+type ContextReport struct {
+	UsedTokens          int
+	DroppedHistoryItems int
+	DroppedTokens       int
+	TruncatedTokens     int // tokens cut from the extracted page content
+}
+
+// itemTokens estimates a history item with the number of its images that will actually be sent
+func (b ContextBudget) itemTokens(item HistoryItem, images int) int {
+	return b.Estimator.Count(item.Content) + images*imageTokens + messageOverhead
+}
+
+// historyTokens estimates each history item. Only the images selectImages picks are sent, so other attachments,
+// such as audio, are free.
+func (b ContextBudget) historyTokens(history []HistoryItem) []int {
+	images := selectImages(b.Vision, history)
+	tokens := make([]int, len(history))
+	for i, item := range history {
+		tokens[i] = b.itemTokens(item, len(images[i]))
+	}
+
+	return tokens
+}
+
+// Fit trims the request to the budget. The system prompt and the request are always kept, the extracted page is
+// truncated to the space left after them, and the history is dropped oldest-first until the rest fits.
+// History items without a timestamp are considered the oldest.
+func (b ContextBudget) Fit(system string, request string, page string, history []HistoryItem) (string, []HistoryItem, ContextReport) {
+	var report ContextReport
+	if b.Window <= 0 {
+		report.UsedTokens = b.Estimate(system, request, page, history)
+		return page, history, report
+	}
+
+	available := b.Window - b.ResponseReserve
+	available -= b.Estimator.Count(system) + messageOverhead
+	available -= b.Estimator.Count(request) + messageOverhead
+
+	if page != "" {
+		pageTokens := b.Estimator.Count(page)
+		truncated, cut := b.Estimator.Truncate(page, max(available, 0))
+		if cut {
+			report.TruncatedTokens = pageTokens - b.Estimator.Count(truncated)
+			page = truncated
+		}
+
+		available -= b.Estimator.Count(page)
+	}
+
+	itemTokens := b.historyTokens(history)
+	historyTokens := 0
+	for _, tokens := range itemTokens {
+		historyTokens += tokens
+	}
+
+	if historyTokens > available {
+		order := make([]int, len(history))
+		for i := range order {
+			order[i] = i
+		}
+
+		sort.SliceStable(order, func(i, j int) bool {
+			return history[order[i]].CreatedAt.Before(history[order[j]].CreatedAt)
+		})
+
+		dropped := make(map[int]bool)
+		for _, index := range order {
+			if historyTokens <= available {
+				break
+			}
+
+			tokens := itemTokens[index]
+			dropped[index] = true
+			historyTokens -= tokens
+			report.DroppedHistoryItems++
+			report.DroppedTokens += tokens
+		}
+
+		kept := make([]HistoryItem, 0, len(history)-len(dropped))
+		for i, item := range history {
+			if !dropped[i] {
+				kept = append(kept, item)
+			}
+		}
+
+		history = kept
+	}
+
+	report.UsedTokens = b.Window - b.ResponseReserve - available + historyTokens
+	return page, history, report
+}
+
+// Estimate returns the approximate prompt size of the request before anything is trimmed
+func (b ContextBudget) Estimate(system string, request string, page string, history []HistoryItem) int {
+	tokens := b.Estimator.Count(system) + b.Estimator.Count(request) + b.Estimator.Count(page) + 2*messageOverhead
+	for _, itemTokens := range b.historyTokens(history) {
+		tokens += itemTokens
+	}
+
+	return tokens
+}
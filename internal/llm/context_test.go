@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"discord-military-analyst-bot/internal/config"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestContextBudgetImages(t *testing.T) {
+	image := &discordgo.MessageAttachment{ID: "1", Filename: "map.png", ContentType: "image/png", Size: 1000}
+	audio := &discordgo.MessageAttachment{ID: "2", Filename: "voice.ogg", ContentType: "audio/ogg", Size: 1000}
+	history := []HistoryItem{{Content: "look", Attachments: []*discordgo.MessageAttachment{image, audio}}}
+
+	budget := ContextBudget{Estimator: TokenEstimator{CharsPerToken: 4}}
+	base := budget.Estimate("", "", "", []HistoryItem{{Content: "look"}})
+
+	if got := budget.Estimate("", "", "", history); got != base {
+		t.Errorf("with vision off, estimate = %d, want %d", got, base)
+	}
+
+	budget.Vision = config.VisionConfig{Enabled: true, MaxImages: 4, MaxImageBytes: 1 << 20}
+	if got := budget.Estimate("", "", "", history); got != base+imageTokens {
+		t.Errorf("with vision on, estimate = %d, want %d (the audio file is free)", got, base+imageTokens)
+	}
+}
+
+func TestContextBudgetFit(t *testing.T) {
+	now := time.Now()
+	history := []HistoryItem{
+		{Content: "newest", CreatedAt: now},
+		{Content: "oldest message in the history", CreatedAt: now.Add(-time.Hour)},
+	}
+
+	unlimited := ContextBudget{Estimator: TokenEstimator{CharsPerToken: 4}}
+	page, kept, _ := unlimited.Fit("system", "request", "a long page", history)
+	if page != "a long page" || len(kept) != 2 {
+		t.Errorf("without a window, got page %q and %d items", page, len(kept))
+	}
+
+	budget := ContextBudget{Window: 24, Estimator: TokenEstimator{CharsPerToken: 4}}
+	_, kept, report := budget.Fit("system", "request", "", history)
+	if len(kept) != 1 || kept[0].Content != "newest" || report.DroppedHistoryItems != 1 {
+		t.Errorf("kept %+v, report %+v, want only the newest item", kept, report)
+	}
+}
@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultOllamaEmbedEndpoint = "http://localhost:11434/api/embed"
+
+// Embedder turns texts into vectors whose cosine similarity reflects how related the texts are
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+}
+
+// OpenAIEmbedder uses an OpenAI-compatible /embeddings endpoint
+type OpenAIEmbedder struct {
+	Endpoint       string
+	Token          string
+	EmbeddingModel string
+	Retry          RetryPolicy
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func NewOpenAIEmbedder(endpoint string, token string, model string, retry RetryPolicy) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		Endpoint:       endpoint,
+		Token:          token,
+		EmbeddingModel: model,
+		Retry:          retry,
+	}
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.EmbeddingModel
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	jsonBody, err := json.Marshal(map[string]any{
+		"model": e.EmbeddingModel,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", e.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+e.Token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := e.Retry.do(ctx, client, jsonBody, newRequest)
+	if err != nil {
+		zap.L().Error("openai embeddings request failed", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result openAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+
+		vectors[item.Index] = item.Embedding
+	}
+
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("no embedding returned for input %d", i)
+		}
+	}
+
+	return vectors, nil
+}
+
+// OllamaEmbedder uses Ollama's native /api/embed endpoint
+type OllamaEmbedder struct {
+	Endpoint       string
+	EmbeddingModel string
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+	Error      string      `json:"error"`
+}
+
+func NewOllamaEmbedder(endpoint string, model string) *OllamaEmbedder {
+	if endpoint == "" {
+		endpoint = DefaultOllamaEmbedEndpoint
+	}
+
+	return &OllamaEmbedder{
+		Endpoint:       endpoint,
+		EmbeddingModel: model,
+	}
+}
+
+func (e *OllamaEmbedder) Model() string {
+	return e.EmbeddingModel
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	jsonBody, err := json.Marshal(map[string]any{
+		"model": e.EmbeddingModel,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.Endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 120 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		zap.L().Error("ollama embed request failed", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ollamaError(resp, body)
+	}
+
+	var result ollamaEmbedResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Error != "" {
+		return nil, errors.New(result.Error)
+	}
+
+	if len(result.Embeddings) != len(texts) {
+		return nil, errors.New("ollama returned a different number of embeddings than inputs")
+	}
+
+	return result.Embeddings, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, 0 if they can't be compared
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestOpenAIEmbed(t *testing.T) {
+	// The data is out of order on purpose, the index decides which input a vector belongs to
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"data": []map[string]any{
+			{"index": 1, "embedding": []float32{0, 1}},
+			{"index": 0, "embedding": []float32{1, 0}},
+		},
+	}))
+	embedder := NewOpenAIEmbedder(server.URL+"/v1/embeddings", "test-token", "text-embedding-3-small", testRetry)
+
+	vectors, err := embedder.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	if len(vectors) != 2 || !slices.Equal(vectors[0], []float32{1, 0}) || !slices.Equal(vectors[1], []float32{0, 1}) {
+		t.Errorf("vectors = %v", vectors)
+	}
+
+	request := server.LastRequest()
+	if request.Header.Get("Authorization") != "Bearer test-token" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+
+	var body struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	if err := request.Decode(&body); err != nil || body.Model != "text-embedding-3-small" || !slices.Equal(body.Input, []string{"first", "second"}) {
+		t.Errorf("unexpected request %s", request)
+	}
+
+	if embedder.Model() != "text-embedding-3-small" {
+		t.Errorf("Model() = %q", embedder.Model())
+	}
+}
+
+func TestOpenAIEmbedMissingVector(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"data": []map[string]any{{"index": 0, "embedding": []float32{1, 0}}},
+	}))
+	embedder := NewOpenAIEmbedder(server.URL+"/v1/embeddings", "", "model", testRetry)
+
+	if _, err := embedder.Embed(context.Background(), []string{"first", "second"}); err == nil {
+		t.Error("Embed succeeded without a vector for every input")
+	}
+}
+
+func TestOllamaEmbed(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"embeddings": [][]float32{{0.5, 0.5}, {1, 0}},
+	}))
+	embedder := NewOllamaEmbedder(server.URL+"/api/embed", "nomic-embed-text")
+
+	vectors, err := embedder.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+
+	if len(vectors) != 2 || !slices.Equal(vectors[0], []float32{0.5, 0.5}) {
+		t.Errorf("vectors = %v", vectors)
+	}
+
+	request := server.LastRequest()
+	if request.Path != "/api/embed" || request.Body["model"] != "nomic-embed-text" {
+		t.Errorf("unexpected request %s", request)
+	}
+}
+
+func TestOllamaEmbedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+	}{
+		{"error status", llmtest.Error(http.StatusNotFound, `{"error":"model not found"}`)},
+		{"error field", llmtest.JSON(map[string]any{"error": "model not found"})},
+		{"count mismatch", llmtest.JSON(map[string]any{"embeddings": [][]float32{{1, 0}}})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, test.response)
+			embedder := NewOllamaEmbedder(server.URL+"/api/embed", "nomic-embed-text")
+
+			if _, err := embedder.Embed(context.Background(), []string{"first", "second"}); err == nil {
+				t.Error("Embed succeeded")
+			}
+		})
+	}
+
+	server := llmtest.NewServer(t, llmtest.Error(http.StatusInternalServerError, `{"error":"out of memory"}`))
+	_, err := NewOllamaEmbedder(server.URL+"/api/embed", "nomic-embed-text").Embed(context.Background(), []string{"first"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrServer) {
+		t.Errorf("err = %v, want an APIError of kind ErrServer", err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{-1, 0}, -1},
+		{[]float32{1, 1}, []float32{1, 0}, 1 / math.Sqrt2},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+
+	for _, test := range tests {
+		if got := CosineSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"cmp"
+	"discord-military-analyst-bot/internal/config"
+	"fmt"
+)
+
+// retryPolicyFromConfig returns the retry policy shared by all HTTP clients
+func retryPolicyFromConfig() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  config.Data.Retry.Attempts,
+		BaseDelay: config.Data.Retry.BaseDelay,
+		MaxDelay:  config.Data.Retry.MaxDelay,
+	}
+}
+
+// NewClient creates a client of the given kind from the provider settings in the config, overriding the endpoint
+// and key if given
+func NewClient(kind config.LLMProvider, endpoint string, apiKey string) (Client, error) {
+	cfg := config.Data
+	switch kind {
+	case config.OpenAI:
+		client := NewOpenAIClient(cmp.Or(endpoint, cfg.OpenAI.Endpoint), cmp.Or(apiKey, cfg.OpenAI.ApiKey), cfg.OpenAI.Temperature, retryPolicyFromConfig())
+		client.Vision = cfg.Vision
+		return client, nil
+	case config.Anthropic:
+		return NewAnthropicClient(
+			cmp.Or(endpoint, cfg.Anthropic.Endpoint),
+			cmp.Or(apiKey, cfg.Anthropic.ApiKey),
+			cfg.Anthropic.Version,
+			cfg.Anthropic.MaxTokens,
+			cfg.Anthropic.Temperature,
+		), nil
+	case config.Gemini:
+		return NewGeminiClient(
+			cmp.Or(endpoint, cfg.Gemini.Endpoint),
+			cmp.Or(apiKey, cfg.Gemini.ApiKey),
+			cfg.Gemini.MaxTokens,
+			cfg.Gemini.Temperature,
+		), nil
+	case config.Ollama:
+		return NewOllamaClient(cmp.Or(endpoint, cfg.Ollama.Endpoint), cfg.Ollama.Defaults, cfg.Ollama.Models), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM inference provider: %d", kind)
+	}
+}
+
+// NewRegistryFromConfig builds the named providers, the fallback chain and the model aliases from the config.
+// The fallback chain is registered as a provider under its own name, so it is used where LLM_PROVIDER or an alias
+// selects it.
+func NewRegistryFromConfig() (*Registry, error) {
+	cfg := config.Data
+	registry := NewRegistry(cfg.DefaultProvider)
+
+	for name, provider := range cfg.Providers {
+		kind, ok := config.ParseProvider(provider.Kind)
+		if !ok {
+			return nil, fmt.Errorf("provider %q: unknown kind %q", name, provider.Kind)
+		}
+
+		client, err := NewClient(kind, provider.Endpoint, provider.ApiKey)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+
+		registry.AddProvider(name, client, provider.Model)
+	}
+
+	if len(cfg.Fallback.Targets) > 0 {
+		if _, ok := cfg.Providers[cfg.Fallback.Name]; ok {
+			return nil, fmt.Errorf("fallback chain name %q is already used by a provider", cfg.Fallback.Name)
+		}
+
+		fallbackClient := NewFallbackClient(cfg.Fallback.FailureThreshold, cfg.Fallback.ProbeInterval)
+		for _, target := range cfg.Fallback.Targets {
+			client, model, err := fallbackTargetClient(target)
+			if err != nil {
+				return nil, err
+			}
+
+			// Without a model of its own the target serves whatever model the request asks for
+			name := target.Provider
+			if model != "" {
+				name += "/" + model
+			}
+
+			fallbackClient.AddTarget(name, client, model)
+		}
+
+		registry.AddProvider(cfg.Fallback.Name, fallbackClient, cfg.Model)
+	}
+
+	for alias, target := range cfg.Aliases {
+		if err := registry.AddAlias(alias, target.Provider, target.Model); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// fallbackTargetClient creates the client of a fallback target, which names either a configured provider or a kind
+func fallbackTargetClient(target config.FallbackTarget) (Client, string, error) {
+	kindName, endpoint, apiKey, model := target.Provider, target.Endpoint, target.ApiKey, target.Model
+	if provider, ok := config.Data.Providers[target.Provider]; ok {
+		kindName = provider.Kind
+		endpoint = cmp.Or(endpoint, provider.Endpoint)
+		apiKey = cmp.Or(apiKey, provider.ApiKey)
+		model = cmp.Or(model, provider.Model)
+	}
+
+	kind, ok := config.ParseProvider(kindName)
+	if !ok {
+		return nil, "", fmt.Errorf("fallback target: unknown provider %q", target.Provider)
+	}
+
+	client, err := NewClient(kind, endpoint, apiKey)
+	return client, model, err
+}
+
+// NewEmbedderFromConfig creates the embeddings client, or returns nil if retrieval is disabled
+func NewEmbedderFromConfig() (Embedder, error) {
+	cfg := config.Data.Embeddings
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "openai":
+		return NewOpenAIEmbedder(cfg.Endpoint, cmp.Or(cfg.ApiKey, config.Data.OpenAI.ApiKey), cfg.Model, retryPolicyFromConfig()), nil
+	case "ollama":
+		return NewOllamaEmbedder(cfg.Endpoint, cfg.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown embeddings provider: %s", cfg.Provider)
+	}
+}
+
+// NewTranscriberFromConfig creates the speech-to-text client, or returns nil if transcription is disabled
+func NewTranscriberFromConfig() Transcriber {
+	cfg := config.Data.Transcription
+	if cfg.Endpoint == "" {
+		return nil
+	}
+
+	return NewOpenAITranscriber(cfg.Endpoint, cmp.Or(cfg.ApiKey, config.Data.OpenAI.ApiKey), cfg.Model, cfg.Language, retryPolicyFromConfig())
+}
+
+// NewSynthesizerFromConfig creates the text-to-speech client, or returns nil if spoken replies are disabled
+func NewSynthesizerFromConfig() Synthesizer {
+	cfg := config.Data.Speech
+	if cfg.Endpoint == "" {
+		return nil
+	}
+
+	return NewOpenAISynthesizer(cfg.Endpoint, cmp.Or(cfg.ApiKey, config.Data.OpenAI.ApiKey), cfg.Model, cfg.Format, retryPolicyFromConfig())
+}
+
+// NewImageGeneratorFromConfig creates the image generation client, or returns nil if no image endpoint or model is set
+func NewImageGeneratorFromConfig() ImageGenerator {
+	if config.Data.OpenAI.ImageEndpoint == "" || config.Data.ImageModel == "" {
+		return nil
+	}
+
+	cfg := config.Data.Images
+	return NewOpenAIImageClient(config.Data.OpenAI.ImageEndpoint, cfg.EditEndpoint, cfg.EditMode, config.Data.OpenAI.ApiKey, cfg.ResponseFormat, retryPolicyFromConfig())
+}
+
+// NewModeratorFromConfig creates the content moderator, or returns nil if moderation is disabled. The classifier
+// uses the given chat client.
+func NewModeratorFromConfig(client Client) Moderator {
+	cfg := config.Data.Moderation
+	switch cfg.Provider {
+	case "openai":
+		return NewOpenAIModerator(cfg.Endpoint, cmp.Or(cfg.ApiKey, config.Data.OpenAI.ApiKey), cfg.Model, retryPolicyFromConfig())
+	case "llm":
+		return NewClassifierModerator(client, cmp.Or(cfg.Model, config.Data.Model), cfg.Categories)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"testing"
+
+	"discord-military-analyst-bot/internal/config"
+)
+
+// withConfig replaces the global config for the duration of the test
+func withConfig(t *testing.T, cfg *config.Config) {
+	previous := config.Data
+	config.Data = cfg
+	t.Cleanup(func() { config.Data = previous })
+}
+
+func TestNewRegistryFromConfigFallback(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultProvider string
+		wantProvider    string
+	}{
+		{"selected by name", "fallback", "fallback"},
+		{"not selected", "local", "local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, &config.Config{
+				Model:           "llama3.1:8b",
+				DefaultProvider: tt.defaultProvider,
+				Providers:       map[string]config.ProviderConfig{"local": {Kind: "ollama"}},
+				Fallback:        config.FallbackConfig{Name: "fallback", Targets: []config.FallbackTarget{{Provider: "local"}, {Provider: "openai"}}},
+			})
+
+			registry, err := NewRegistryFromConfig()
+			if err != nil {
+				t.Fatalf("NewRegistryFromConfig: %v", err)
+			}
+
+			if provider, _, _ := registry.Resolve(""); provider != tt.wantProvider {
+				t.Errorf("default provider = %q, want %q", provider, tt.wantProvider)
+			}
+
+			if _, ok := registry.Provider("fallback"); !ok {
+				t.Error("fallback chain not registered under its name")
+			}
+		})
+	}
+}
+
+func TestNewRegistryFromConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{
+			name: "fallback name collision",
+			cfg: &config.Config{
+				DefaultProvider: "fallback",
+				Providers:       map[string]config.ProviderConfig{"fallback": {Kind: "openai"}},
+				Fallback:        config.FallbackConfig{Name: "fallback", Targets: []config.FallbackTarget{{Provider: "openai"}}},
+			},
+		},
+		{
+			name: "unknown provider kind",
+			cfg:  &config.Config{Providers: map[string]config.ProviderConfig{"local": {Kind: "olama"}}},
+		},
+		{
+			name: "unknown fallback target",
+			cfg:  &config.Config{Fallback: config.FallbackConfig{Name: "fallback", Targets: []config.FallbackTarget{{Provider: "olama"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.cfg)
+
+			if _, err := NewRegistryFromConfig(); err == nil {
+				t.Error("NewRegistryFromConfig succeeded, want an error")
+			}
+		})
+	}
+}
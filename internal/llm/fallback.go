@@ -0,0 +1,334 @@
+package llm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FallbackClient tries an ordered list of targets until one of them answers. A target that keeps failing gets its
+// circuit opened and is skipped until a background health probe succeeds.
+type FallbackClient struct {
+	FailureThreshold int           // consecutive failures before a target's circuit opens
+	ProbeInterval    time.Duration // how often targets with an open circuit are probed
+
+	targets []*fallbackTarget
+}
+
+type fallbackTarget struct {
+	name   string
+	client Client
+	model  string
+
+	mu        sync.Mutex
+	failures  int
+	open      bool
+	lastModel string // the model of the latest response, used to probe targets without a model of their own
+}
+
+func NewFallbackClient(failureThreshold int, probeInterval time.Duration) *FallbackClient {
+	return &FallbackClient{
+		FailureThreshold: failureThreshold,
+		ProbeInterval:    probeInterval,
+	}
+}
+
+// AddTarget appends a target to the chain. If model is empty, the model of the request is used.
+func (c *FallbackClient) AddTarget(name string, client Client, model string) {
+	c.targets = append(c.targets, &fallbackTarget{name: name, client: client, model: model})
+}
+
+func (t *fallbackTarget) modelFor(model string) string {
+	if t.model != "" {
+		return t.model
+	}
+
+	return model
+}
+
+func (t *fallbackTarget) isOpen() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.open
+}
+
+func (t *fallbackTarget) recordSuccess(model string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if model != "" {
+		t.lastModel = model
+	}
+
+	if t.open {
+		zap.L().Info("circuit closed", zap.String("target", t.name))
+	}
+
+	t.failures = 0
+	t.open = false
+}
+
+func (t *fallbackTarget) recordFailure(threshold int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failures++
+	if !t.open && t.failures >= threshold {
+		zap.L().Warn("circuit opened", zap.String("target", t.name), zap.Int("failures", t.failures))
+		t.open = true
+	}
+}
+
+// probeModel returns the model to probe the target with, empty if it hasn't served anything yet
+func (t *fallbackTarget) probeModel() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return cmp.Or(t.model, t.lastModel)
+}
+
+// candidates returns the targets with a closed circuit, or all of them if every circuit is open,
+// since trying a target that might have recovered beats failing outright
+func (c *FallbackClient) candidates() []*fallbackTarget {
+	candidates := make([]*fallbackTarget, 0, len(c.targets))
+	for _, target := range c.targets {
+		if !target.isOpen() {
+			candidates = append(candidates, target)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return c.targets
+	}
+
+	return candidates
+}
+
+// shouldFallback reports whether another target might succeed where this one failed
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var blockedErr *BlockedError
+	return !errors.As(err, &blockedErr)
+}
+
+func (c *FallbackClient) failed(ctx context.Context, target *fallbackTarget, err error) {
+	zap.L().Warn("fallback target failed", zap.String("target", target.name), zap.Error(err))
+
+	// Oversized requests and cancellations say nothing about the target's health
+	if ctx.Err() == nil && !errors.Is(err, ErrContextLength) {
+		target.recordFailure(c.FailureThreshold)
+	}
+}
+
+func (c *FallbackClient) served(ctx context.Context, target *fallbackTarget, model string) {
+	target.recordSuccess(target.modelFor(model))
+	zap.L().Debug("response served", zap.String("target", target.name), zap.String("model", target.modelFor(model)))
+
+	if info := responseInfoFromContext(ctx); info != nil {
+		info.ServedBy = target.name
+		info.Model = target.modelFor(model)
+	}
+}
+
+func (c *FallbackClient) Infer(ctx context.Context, request Request) (string, error) {
+	err := errors.New("no fallback targets configured")
+	for _, target := range c.candidates() {
+		var response string
+		response, err = target.client.Infer(ctx, request.withModel(target.modelFor(request.Model)))
+		if err == nil {
+			c.served(ctx, target, request.Model)
+			return response, nil
+		}
+
+		c.failed(ctx, target, err)
+		if !shouldFallback(ctx, err) {
+			return "", err
+		}
+	}
+
+	return "", err
+}
+
+// InferWithStream streams from the first target that answers. Once a target has produced content, its failure is
+// returned as is, since switching targets mid-reply would mix two answers.
+func (c *FallbackClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	err := errors.New("no fallback targets configured")
+	for _, target := range c.candidates() {
+		emitted := false
+		targetCallback := func(content string, done bool) {
+			if content != "" {
+				emitted = true
+			}
+
+			if callback != nil {
+				callback(content, done)
+			}
+		}
+
+		var response string
+		response, err = inferStreamOrFallback(ctx, target.client, request.withModel(target.modelFor(request.Model)), targetCallback)
+		if err == nil {
+			c.served(ctx, target, request.Model)
+			return response, nil
+		}
+
+		c.failed(ctx, target, err)
+		if emitted || !shouldFallback(ctx, err) {
+			return response, err
+		}
+	}
+
+	return "", err
+}
+
+func (c *FallbackClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	go func() {
+		defer close(responseChan)
+
+		_, err := c.InferWithStream(ctx, request, func(content string, done bool) {
+			responseChan <- StreamResponse{Content: content, Done: done}
+		})
+
+		if err != nil {
+			responseChan <- StreamResponse{Error: err}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// InferWithTools runs the step on the first target that answers. Targets without tool support are used without
+// tools on the first step and skipped once tool results have to be passed back.
+func (c *FallbackClient) InferWithTools(ctx context.Context, request Request, steps []HistoryItem, tools []Tool, callback func(content string, done bool)) (string, []ToolCall, error) {
+	err := errors.New("no fallback target supports tools")
+	for _, target := range c.candidates() {
+		toolClient, supportsTools := target.client.(ToolClient)
+		if !supportsTools && len(steps) > 0 {
+			continue
+		}
+
+		emitted := false
+		targetCallback := func(content string, done bool) {
+			if content != "" {
+				emitted = true
+			}
+
+			if callback != nil {
+				callback(content, done)
+			}
+		}
+
+		var response string
+		var toolCalls []ToolCall
+		if supportsTools {
+			response, toolCalls, err = toolClient.InferWithTools(ctx, request.withModel(target.modelFor(request.Model)), steps, tools, targetCallback)
+		} else {
+			response, err = inferStreamOrFallback(ctx, target.client, request.withModel(target.modelFor(request.Model)), targetCallback)
+		}
+
+		if err == nil {
+			c.served(ctx, target, request.Model)
+			return response, toolCalls, nil
+		}
+
+		c.failed(ctx, target, err)
+		if emitted || !shouldFallback(ctx, err) {
+			return response, nil, err
+		}
+	}
+
+	return "", nil, err
+}
+
+// InferJSON runs the structured call on the first target that answers. Once a target without structured output
+// support is reached, ErrStructuredUnsupported is returned so the caller retries with the schema in the prompt.
+func (c *FallbackClient) InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error) {
+	err := ErrStructuredUnsupported
+	for _, target := range c.candidates() {
+		structuredClient, ok := target.client.(StructuredClient)
+		if !ok {
+			return "", ErrStructuredUnsupported
+		}
+
+		var response string
+		response, err = structuredClient.InferJSON(ctx, request.withModel(target.modelFor(request.Model)), schema)
+		if err == nil {
+			c.served(ctx, target, request.Model)
+			return response, nil
+		}
+
+		if errors.Is(err, ErrStructuredUnsupported) {
+			return "", err
+		}
+
+		c.failed(ctx, target, err)
+		if !shouldFallback(ctx, err) {
+			return "", err
+		}
+	}
+
+	return "", err
+}
+
+// StartProbes periodically checks the targets with an open circuit until the context is done
+func (c *FallbackClient) StartProbes(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.ProbeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.probe(ctx)
+			}
+		}
+	}()
+}
+
+func (c *FallbackClient) probe(ctx context.Context) {
+	for _, target := range c.targets {
+		model := target.probeModel()
+		if !target.isOpen() || model == "" {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		_, err := target.client.Infer(probeCtx, Request{Model: model, System: "Reply with OK.", Message: "ping"})
+		cancel()
+
+		if err != nil {
+			zap.L().Debug("health probe failed", zap.String("target", target.name), zap.Error(err))
+			continue
+		}
+
+		target.recordSuccess(model)
+	}
+}
+
+// inferStreamOrFallback streams if the client supports it and otherwise delivers the whole response as one chunk
+func inferStreamOrFallback(ctx context.Context, client Client, request Request, callback func(content string, done bool)) (string, error) {
+	if streamClient, ok := client.(StreamClient); ok {
+		return streamClient.InferWithStream(ctx, request, callback)
+	}
+
+	response, err := client.Infer(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	callback(response, false)
+	callback("", true)
+	return response, nil
+}
@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestFallbackRequestModel(t *testing.T) {
+	broken := llmtest.NewServer(t, llmtest.Error(400, `{"error":{"message":"bad request"}}`))
+	working := llmtest.NewServer(t, llmtest.Completion("Hi"))
+
+	client := NewFallbackClient(1, time.Minute)
+	client.AddTarget("broken", newTestClient(broken), "")
+	client.AddTarget("working", newTestClient(working), "")
+
+	request := testRequest()
+	request.Model = "routed-model"
+	if _, err := client.Infer(context.Background(), request); err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	if model := broken.LastRequest().Body["model"]; model != "routed-model" {
+		t.Errorf("first target got model %v, want the request's model", model)
+	}
+	if model := working.LastRequest().Body["model"]; model != "routed-model" {
+		t.Errorf("second target got model %v, want the request's model", model)
+	}
+
+	// The working target's circuit is closed, so only the broken one is probed, with nothing served to go by
+	client.probe(context.Background())
+	if len(broken.Requests()) != 1 {
+		t.Errorf("target without a served model was probed")
+	}
+
+	client.targets[0].recordSuccess("routed-model")
+	client.targets[0].recordFailure(1)
+	broken.Enqueue(llmtest.Completion("OK"))
+	client.probe(context.Background())
+	if model := broken.LastRequest().Body["model"]; model != "routed-model" || client.targets[0].isOpen() {
+		t.Errorf("probe used model %v, want the last served one and a closed circuit", model)
+	}
+}
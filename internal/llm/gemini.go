@@ -0,0 +1,331 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultGeminiEndpoint = "https://generativelanguage.googleapis.com/v1beta"
+
+type GeminiClient struct {
+	Endpoint    string
+	Token       string
+	MaxTokens   int
+	Temperature float64
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     float64  `json:"temperature"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+// GeminiResponse is both the generateContent response and a single SSE chunk of streamGenerateContent
+type GeminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"` // cumulative in stream chunks
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+func (u *geminiUsage) usage() Usage {
+	return Usage{PromptTokens: u.PromptTokenCount, CompletionTokens: u.CandidatesTokenCount}
+}
+
+type geminiErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// geminiBlockingFinishReasons are the finish reasons that mean the candidate was withheld by a filter
+var geminiBlockingFinishReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+}
+
+func NewGeminiClient(endpoint string, token string, maxTokens int, temperature float64) *GeminiClient {
+	if endpoint == "" {
+		endpoint = DefaultGeminiEndpoint
+	}
+
+	provider := &GeminiClient{
+		Endpoint:    strings.TrimSuffix(endpoint, "/"),
+		Token:       token,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+
+	return provider
+}
+
+// buildContents converts the history into Gemini contents, merging consecutive turns of the same role
+func (c *GeminiClient) buildContents(message string, history []HistoryItem) []geminiContent {
+	contents := make([]geminiContent, 0)
+
+	appendTurn := func(role string, text string) {
+		part := geminiPart{Text: text}
+		if len(contents) > 0 && contents[len(contents)-1].Role == role {
+			contents[len(contents)-1].Parts = append(contents[len(contents)-1].Parts, part)
+			return
+		}
+
+		contents = append(contents, geminiContent{Role: role, Parts: []geminiPart{part}})
+	}
+
+	for _, item := range history {
+		if item.Content == "" {
+			continue
+		}
+
+		role := "user"
+		if item.IsBotMessage {
+			role = "model"
+		}
+
+		appendTurn(role, item.Content)
+	}
+
+	appendTurn("user", message)
+	return contents
+}
+
+func (c *GeminiClient) newRequest(ctx context.Context, request Request, stream bool) (*http.Request, error) {
+	requestBody := geminiRequest{
+		Contents: c.buildContents(request.Message, request.History),
+		GenerationConfig: geminiGenerationConfig{
+			Temperature:     request.temperature(c.Temperature),
+			MaxOutputTokens: c.MaxTokens,
+			TopP:            request.TopP,
+			StopSequences:   request.Stop,
+			Seed:            request.Seed,
+		},
+	}
+
+	if request.MaxTokens > 0 {
+		requestBody.GenerationConfig.MaxOutputTokens = request.MaxTokens
+	}
+
+	if request.System != "" {
+		requestBody.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: request.System}}}
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	url := c.Endpoint + "/models/" + request.Model + ":generateContent"
+	if stream {
+		url = c.Endpoint + "/models/" + request.Model + ":streamGenerateContent?alt=sse"
+	}
+
+	zap.L().Debug("gemini request", zap.Bool("stream", stream), zap.String("body", string(jsonBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("x-goog-api-key", c.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+// geminiError classifies a failed response like the other providers, keeping only the status and message of a
+// Gemini error body
+func geminiError(resp *http.Response, body []byte) error {
+	apiErr := newAPIError(resp, body)
+	var errResp geminiErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		apiErr.Body = errResp.Error.Status + ": " + errResp.Error.Message
+	}
+
+	return apiErr
+}
+
+// text returns the text of the first candidate, or a BlockedError if the prompt or the candidate was filtered
+func (r *GeminiResponse) text() (string, error) {
+	if r.PromptFeedback.BlockReason != "" {
+		return "", &BlockedError{Reason: r.PromptFeedback.BlockReason, Prompt: true}
+	}
+
+	if len(r.Candidates) == 0 {
+		return "", nil
+	}
+
+	candidate := r.Candidates[0]
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		text.WriteString(part.Text)
+	}
+
+	if geminiBlockingFinishReasons[candidate.FinishReason] {
+		return text.String(), &BlockedError{Reason: candidate.FinishReason}
+	}
+
+	return text.String(), nil
+}
+
+func (c *GeminiClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	req, err := c.newRequest(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 180 * time.Second}
+
+	go func() {
+		defer close(responseChan)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			zap.L().Error("gemini stream request failed", zap.Error(err))
+			responseChan <- StreamResponse{Error: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			responseChan <- StreamResponse{Error: geminiError(resp, body)}
+			return
+		}
+
+		// Every chunk repeats the usage so far, the last one has the totals
+		var usage *geminiUsage
+		defer func() {
+			if usage != nil {
+				recordUsage(ctx, usage.usage())
+			}
+		}()
+
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				responseChan <- StreamResponse{Error: err}
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			var chunk GeminiResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				zap.L().Error("failed to unmarshal gemini stream chunk", zap.Error(err), zap.String("data", data))
+				continue
+			}
+
+			if chunk.UsageMetadata != nil {
+				usage = chunk.UsageMetadata
+			}
+
+			content, err := chunk.text()
+			if content != "" {
+				responseChan <- StreamResponse{Content: content, Done: false}
+			}
+
+			if err != nil {
+				responseChan <- StreamResponse{Error: err}
+				return
+			}
+		}
+
+		responseChan <- StreamResponse{Done: true}
+	}()
+
+	return responseChan, nil
+}
+
+func (c *GeminiClient) Infer(ctx context.Context, request Request) (string, error) {
+	req, err := c.newRequest(ctx, request, false)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 180 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		zap.L().Error("gemini request failed", zap.Error(err))
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", geminiError(resp, body)
+	}
+
+	var result GeminiResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	if result.UsageMetadata != nil {
+		recordUsage(ctx, result.UsageMetadata.usage())
+	}
+
+	return result.text()
+}
+
+// InferWithStream is a convenience method that collects all streaming chunks into a single response
+func (c *GeminiClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	stream, err := c.InferStream(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	response, _, err := collectStream(ctx, stream, callback)
+	return response, err
+}
@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func geminiChunk(text string, finishReason string) string {
+	candidate := map[string]any{"content": map[string]any{"role": "model", "parts": []map[string]any{{"text": text}}}}
+	if finishReason != "" {
+		candidate["finishReason"] = finishReason
+	}
+
+	return llmtest.Event(map[string]any{"candidates": []map[string]any{candidate}})
+}
+
+func geminiUsageChunk(text string, promptTokens int, candidatesTokens int) string {
+	return llmtest.Event(map[string]any{
+		"candidates":    []map[string]any{{"content": map[string]any{"role": "model", "parts": []map[string]any{{"text": text}}}}},
+		"usageMetadata": map[string]any{"promptTokenCount": promptTokens, "candidatesTokenCount": candidatesTokens},
+	})
+}
+
+func TestGeminiStream(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: llmtest.Split(20,
+		geminiUsageChunk("Hello", 15, 1),
+		geminiChunk(", world", "STOP"),
+		geminiUsageChunk("", 15, 4),
+	)})
+	client := NewGeminiClient(server.URL+"/v1beta", "test-token", 0, 0.7)
+
+	ctx, info := WithResponseInfo(context.Background())
+	response, err := client.InferWithStream(ctx, testRequest(), nil)
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+
+	if response != "Hello, world" {
+		t.Errorf("response = %q, want %q", response, "Hello, world")
+	}
+
+	if info.Usage.PromptTokens != 15 || info.Usage.CompletionTokens != 4 {
+		t.Errorf("usage = %+v, want 15 prompt and 4 completion tokens", info.Usage)
+	}
+
+	request := server.LastRequest()
+	if request.Path != "/v1beta/models/test-model:streamGenerateContent" || request.Header.Get("x-goog-api-key") != "test-token" {
+		t.Errorf("unexpected request %s", request)
+	}
+}
+
+func TestGeminiBlocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+		stream   bool
+		want     BlockedError
+		partial  string
+	}{
+		{
+			name:     "prompt feedback",
+			response: llmtest.JSON(map[string]any{"promptFeedback": map[string]any{"blockReason": "SAFETY"}}),
+			want:     BlockedError{Reason: "SAFETY", Prompt: true},
+		},
+		{
+			name: "safety finish reason",
+			response: llmtest.JSON(map[string]any{"candidates": []map[string]any{{
+				"content":      map[string]any{"parts": []map[string]any{{"text": "Partial"}}},
+				"finishReason": "SAFETY",
+			}}}),
+			want:    BlockedError{Reason: "SAFETY"},
+			partial: "Partial",
+		},
+		{
+			name:     "prompt feedback in stream",
+			response: llmtest.Response{Chunks: []string{llmtest.Event(map[string]any{"promptFeedback": map[string]any{"blockReason": "OTHER"}})}},
+			stream:   true,
+			want:     BlockedError{Reason: "OTHER", Prompt: true},
+		},
+		{
+			name:     "safety finish reason in stream",
+			response: llmtest.Response{Chunks: []string{geminiChunk("Partial", ""), geminiChunk("", "SAFETY")}},
+			stream:   true,
+			want:     BlockedError{Reason: "SAFETY"},
+			partial:  "Partial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, tt.response)
+			client := NewGeminiClient(server.URL+"/v1beta", "test-token", 0, 0.7)
+
+			var response string
+			var err error
+			if tt.stream {
+				response, err = client.InferWithStream(context.Background(), testRequest(), nil)
+			} else {
+				response, err = client.Infer(context.Background(), testRequest())
+			}
+
+			var blocked *BlockedError
+			if !errors.As(err, &blocked) || *blocked != tt.want {
+				t.Fatalf("error = %v, want %+v", err, tt.want)
+			}
+
+			if response != tt.partial {
+				t.Errorf("response = %q, want %q", response, tt.partial)
+			}
+		})
+	}
+}
+
+func TestGeminiUsage(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"candidates":    []map[string]any{{"content": map[string]any{"parts": []map[string]any{{"text": "Fine"}}}, "finishReason": "STOP"}},
+		"usageMetadata": map[string]any{"promptTokenCount": 25, "candidatesTokenCount": 2, "totalTokenCount": 27},
+	}))
+	client := NewGeminiClient(server.URL+"/v1beta", "test-token", 0, 0.7)
+
+	ctx, info := WithResponseInfo(context.Background())
+	if _, err := client.Infer(ctx, testRequest()); err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	if info.Usage.PromptTokens != 25 || info.Usage.CompletionTokens != 2 {
+		t.Errorf("usage = %+v, want 25 prompt and 2 completion tokens", info.Usage)
+	}
+}
+
+func TestGeminiAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+		want     error
+	}{
+		{"rate limited", llmtest.Error(http.StatusTooManyRequests, `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`), ErrRateLimited},
+		{"context length", llmtest.Error(http.StatusBadRequest, `{"error":{"code":400,"message":"The input token count exceeds the maximum context length","status":"INVALID_ARGUMENT"}}`), ErrContextLength},
+		{"forbidden", llmtest.Error(http.StatusForbidden, `{"error":{"code":403,"message":"API key not valid","status":"PERMISSION_DENIED"}}`), ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, tt.response, tt.response)
+			client := NewGeminiClient(server.URL+"/v1beta", "test-token", 0, 0.7)
+
+			_, err := client.Infer(context.Background(), testRequest())
+			_, streamErr := client.InferWithStream(context.Background(), testRequest(), nil)
+			for _, err := range []error{err, streamErr} {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || !errors.Is(err, tt.want) {
+					t.Errorf("error = %v, want an APIError of kind %v", err, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const maxImageBytes = 50 * 1024 * 1024
+
+var ErrImageEditUnsupported = errors.New("image editing is not configured")
+
+// ImageRequest describes an image to generate
+type ImageRequest struct {
+	Model  string
+	Prompt string
+	Size   string // e.g. "1024x1024", the provider's default if empty
+	Seed   *int
+	Source *ImageSource // image to edit, nil to generate a new one
+}
+
+// ImageSource is an existing image to edit. Edit endpoints need the data, img2img requests use the URL if there is one.
+type ImageSource struct {
+	URL         string
+	Data        []byte
+	Filename    string
+	ContentType string
+}
+
+// Image is a generated image
+type Image struct {
+	Data          []byte
+	ContentType   string
+	RevisedPrompt string // the prompt the provider actually used, if it rewrote it
+}
+
+// ImageGenerator creates images from text
+type ImageGenerator interface {
+	GenerateImage(ctx context.Context, request ImageRequest) (*Image, error)
+}
+
+// OpenAIImageClient uses an OpenAI or Together style /images/generations endpoint. Images are accepted both as
+// base64 and as URLs, which are downloaded. Images are edited either through an /images/edits endpoint
+// ("edits" mode) or by sending the source as image_url to the generations endpoint ("img2img" mode).
+type OpenAIImageClient struct {
+	Endpoint       string
+	EditEndpoint   string
+	EditMode       string // "edits", "img2img" or empty if editing is not supported
+	Token          string
+	ResponseFormat string // "b64_json" or "url", not sent if empty since some providers reject it
+	Retry          RetryPolicy
+}
+
+type openAIImageResponse struct {
+	Data []struct {
+		B64JSON       string `json:"b64_json"`
+		URL           string `json:"url"`
+		RevisedPrompt string `json:"revised_prompt"`
+	} `json:"data"`
+}
+
+func NewOpenAIImageClient(endpoint string, editEndpoint string, editMode string, token string, responseFormat string, retry RetryPolicy) *OpenAIImageClient {
+	return &OpenAIImageClient{
+		Endpoint:       endpoint,
+		EditEndpoint:   editEndpoint,
+		EditMode:       editMode,
+		Token:          token,
+		ResponseFormat: responseFormat,
+		Retry:          retry,
+	}
+}
+
+func (c *OpenAIImageClient) GenerateImage(ctx context.Context, request ImageRequest) (*Image, error) {
+	if request.Source != nil && c.EditMode == "edits" {
+		return c.editImage(ctx, request)
+	}
+
+	requestBody := map[string]any{
+		"model":  request.Model,
+		"prompt": request.Prompt,
+		"n":      1,
+	}
+
+	if request.Size != "" {
+		requestBody["size"] = request.Size
+	}
+	if request.Seed != nil {
+		requestBody["seed"] = *request.Seed
+	}
+	if c.ResponseFormat != "" {
+		requestBody["response_format"] = c.ResponseFormat
+	}
+
+	endpoint := c.Endpoint
+	if request.Source != nil {
+		if c.EditMode != "img2img" {
+			return nil, ErrImageEditUnsupported
+		}
+
+		requestBody["image_url"] = request.Source.URL
+		if request.Source.URL == "" {
+			requestBody["image_url"] = "data:" + request.Source.ContentType + ";base64," + base64.StdEncoding.EncodeToString(request.Source.Data)
+		}
+
+		endpoint = cmp.Or(c.EditEndpoint, c.Endpoint)
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	zap.L().Debug("image request", zap.String("body", string(jsonBody)))
+	return c.send(ctx, endpoint, jsonBody, "application/json")
+}
+
+// editImage sends the source image with the prompt to an /images/edits endpoint as a multipart form
+func (c *OpenAIImageClient) editImage(ctx context.Context, request ImageRequest) (*Image, error) {
+	if len(request.Source.Data) == 0 {
+		return nil, errors.New("image edit needs the source image data")
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	file, err := form.CreateFormFile("image", cmp.Or(request.Source.Filename, "image.png"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Write(request.Source.Data); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{
+		"model":           request.Model,
+		"prompt":          request.Prompt,
+		"n":               "1",
+		"size":            request.Size,
+		"response_format": c.ResponseFormat,
+	}
+
+	if request.Seed != nil {
+		fields["seed"] = strconv.Itoa(*request.Seed)
+	}
+
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+
+		if err := form.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	zap.L().Debug("image edit request", zap.String("model", request.Model), zap.String("prompt", request.Prompt))
+	return c.send(ctx, cmp.Or(c.EditEndpoint, c.Endpoint), body.Bytes(), form.FormDataContentType())
+}
+
+// send posts an image request and reads the first image of the response
+func (c *OpenAIImageClient) send(ctx context.Context, endpoint string, requestBody []byte, contentType string) (*Image, error) {
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}
+
+	client := &http.Client{Timeout: 300 * time.Second}
+	resp, err := c.Retry.do(ctx, client, requestBody, newRequest)
+	if err != nil {
+		zap.L().Error("image request failed", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result openAIImageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Data) == 0 {
+		return nil, errors.New("image response has no data")
+	}
+
+	return imageFromResponse(ctx, result.Data[0].B64JSON, result.Data[0].URL, result.Data[0].RevisedPrompt)
+}
+
+// imageFromResponse decodes a base64 image or downloads it from its URL
+func imageFromResponse(ctx context.Context, b64 string, url string, revisedPrompt string) (*Image, error) {
+	image := &Image{RevisedPrompt: revisedPrompt}
+
+	switch {
+	case b64 != "":
+		data, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, err
+		}
+
+		image.Data = data
+	case url != "":
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		client := &http.Client{Timeout: 60 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status downloading image: %s", resp.Status)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) > maxImageBytes {
+			return nil, errors.New("generated image exceeds size limit")
+		}
+
+		image.Data = data
+		image.ContentType = resp.Header.Get("Content-Type")
+	default:
+		return nil, errors.New("image response has neither b64_json nor url")
+	}
+
+	if image.ContentType == "" || image.ContentType == "application/octet-stream" {
+		image.ContentType = http.DetectContentType(image.Data)
+	}
+
+	return image, nil
+}
@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func imageResponse() llmtest.Response {
+	return llmtest.JSON(map[string]any{
+		"data": []map[string]any{{"b64_json": base64.StdEncoding.EncodeToString(pngHeader)}},
+	})
+}
+
+func TestGenerateImage(t *testing.T) {
+	server := llmtest.NewServer(t, imageResponse())
+	client := NewOpenAIImageClient(server.URL+"/v1/images/generations", "", "", "test-token", "b64_json", testRetry)
+
+	seed := 7
+	image, err := client.GenerateImage(context.Background(), ImageRequest{Model: "flux", Prompt: "a tank", Size: "512x512", Seed: &seed})
+	if err != nil {
+		t.Fatalf("GenerateImage: %v", err)
+	}
+
+	if string(image.Data) != string(pngHeader) || image.ContentType != "image/png" {
+		t.Errorf("image = %q (%s)", image.Data, image.ContentType)
+	}
+
+	body := server.LastRequest().Body
+	if body["prompt"] != "a tank" || body["size"] != "512x512" || body["seed"] != 7.0 || body["response_format"] != "b64_json" {
+		t.Errorf("unexpected request %s", server.LastRequest())
+	}
+}
+
+func TestGenerateImageFromURL(t *testing.T) {
+	server := llmtest.NewServer(t)
+	server.Enqueue(
+		llmtest.JSON(map[string]any{"data": []map[string]any{{"url": server.URL + "/image.png", "revised_prompt": "a green tank"}}}),
+		llmtest.Response{Body: string(pngHeader), Header: map[string]string{"Content-Type": "image/png"}},
+	)
+	client := NewOpenAIImageClient(server.URL+"/v1/images/generations", "", "", "test-token", "", testRetry)
+
+	image, err := client.GenerateImage(context.Background(), ImageRequest{Model: "flux", Prompt: "a tank"})
+	if err != nil {
+		t.Fatalf("GenerateImage: %v", err)
+	}
+
+	if string(image.Data) != string(pngHeader) || image.RevisedPrompt != "a green tank" {
+		t.Errorf("image = %q, revised prompt %q", image.Data, image.RevisedPrompt)
+	}
+
+	if _, ok := server.Requests()[0].Body["response_format"]; ok {
+		t.Error("response_format sent although it isn't configured")
+	}
+}
+
+func TestEditImage(t *testing.T) {
+	source := &ImageSource{URL: "https://cdn.example/tank.png", Data: pngHeader, Filename: "tank.png", ContentType: "image/png"}
+
+	t.Run("img2img", func(t *testing.T) {
+		server := llmtest.NewServer(t, imageResponse())
+		client := NewOpenAIImageClient(server.URL+"/v1/images/generations", "", "img2img", "test-token", "", testRetry)
+
+		if _, err := client.GenerateImage(context.Background(), ImageRequest{Model: "kontext", Prompt: "darker", Source: source}); err != nil {
+			t.Fatalf("GenerateImage: %v", err)
+		}
+
+		request := server.LastRequest()
+		if request.Path != "/v1/images/generations" || request.Body["image_url"] != source.URL {
+			t.Errorf("unexpected request %s", request)
+		}
+	})
+
+	t.Run("edits", func(t *testing.T) {
+		server := llmtest.NewServer(t, imageResponse())
+		client := NewOpenAIImageClient(server.URL+"/v1/images/generations", server.URL+"/v1/images/edits", "edits", "test-token", "", testRetry)
+
+		if _, err := client.GenerateImage(context.Background(), ImageRequest{Model: "gpt-image-1", Prompt: "darker", Source: source}); err != nil {
+			t.Fatalf("GenerateImage: %v", err)
+		}
+
+		request := server.LastRequest()
+		if request.Path != "/v1/images/edits" || !strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data") {
+			t.Fatalf("unexpected request %s", request)
+		}
+
+		raw := string(request.Raw)
+		for _, want := range []string{`name="image"; filename="tank.png"`, "darker", "gpt-image-1", string(pngHeader)} {
+			if !strings.Contains(raw, want) {
+				t.Errorf("multipart body is missing %q", want)
+			}
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		server := llmtest.NewServer(t)
+		client := NewOpenAIImageClient(server.URL+"/v1/images/generations", "", "", "test-token", "", testRetry)
+
+		_, err := client.GenerateImage(context.Background(), ImageRequest{Model: "flux", Prompt: "darker", Source: source})
+		if !errors.Is(err, ErrImageEditUnsupported) {
+			t.Errorf("error = %v, want %v", err, ErrImageEditUnsupported)
+		}
+	})
+}
+
+func TestGenerateImageTooLarge(t *testing.T) {
+	server := llmtest.NewServer(t)
+	server.Enqueue(
+		llmtest.JSON(map[string]any{"data": []map[string]any{{"url": server.URL + "/image.png"}}}),
+		llmtest.Response{Body: strings.Repeat("x", maxImageBytes+1), Header: map[string]string{"Content-Type": "image/png"}},
+	)
+	client := NewOpenAIImageClient(server.URL+"/v1/images/generations", "", "", "test-token", "", testRetry)
+
+	if _, err := client.GenerateImage(context.Background(), ImageRequest{Model: "flux", Prompt: "a tank"}); err == nil {
+		t.Error("oversized image accepted instead of failing")
+	}
+}
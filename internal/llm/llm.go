@@ -2,32 +2,161 @@ package llm
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 // StreamResponse represents a chunk of the streaming response
 type StreamResponse struct {
-	Content string
-	Done    bool
-	Error   error
+	Content   string
+	Done      bool
+	Error     error
+	ToolCalls []ToolCall // set on the final chunk if the model asked for tools
+	Reasoning string     // thinking of reasoning models, not part of the response
 }
 
 // StreamClient is an optional interface that clients can implement to support streaming
 type StreamClient interface {
 	// InferStream returns a channel that streams response chunks
-	InferStream(ctx context.Context, model string, system string, message string, history []HistoryItem) (<-chan StreamResponse, error)
+	InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error)
 
 	// InferWithStream is a convenience method that collects all streaming chunks and calls the callback for each chunk
-	InferWithStream(ctx context.Context, model string, system string, message string, history []HistoryItem, callback func(content string, done bool)) (string, error)
+	InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error)
+}
+
+// BlockedError is returned when the provider withheld the prompt or the response because of a content filter
+type BlockedError struct {
+	Reason string
+	Prompt bool // true if the prompt itself was rejected, false if the generated response was
+}
+
+func (e *BlockedError) Error() string {
+	if e.Prompt {
+		return "prompt blocked by provider: " + e.Reason
+	}
+
+	return "response blocked by provider: " + e.Reason
+}
+
+// Request is a single inference request. Sampling options left at their zero value use the client's defaults.
+type Request struct {
+	Model   string
+	System  string
+	Message string
+	History []HistoryItem
+
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	Stop        []string
+	Seed        *int
+
+	User string // ID of the end user, passed to providers that track abuse per user
+}
+
+// withModel returns a copy of the request for another model
+func (r Request) withModel(model string) Request {
+	r.Model = model
+	return r
+}
+
+// temperature returns the temperature of the request, or the client's default
+func (r Request) temperature(defaultTemperature float64) float64 {
+	if r.Temperature != nil {
+		return *r.Temperature
+	}
+
+	return defaultTemperature
 }
 
 type Client interface {
-	Infer(ctx context.Context, model string, system string, message string, history []HistoryItem) (string, error)
+	Infer(ctx context.Context, request Request) (string, error)
 }
 
 type HistoryItem struct {
+	ID           string // Discord message ID, empty if unknown
 	Content      string
 	IsBotMessage bool
 	Attachments  []*discordgo.MessageAttachment
+	ToolCalls    []ToolCall // tool calls requested by the model in this turn
+	ToolCallID   string     // set if this item is the result of a tool call
+	CreatedAt    time.Time
+}
+
+// collectStream drains a response stream into a single string, calling the callback for each chunk.
+// Reasoning is passed to the ResponseInfo of the context instead.
+func collectStream(ctx context.Context, stream <-chan StreamResponse, callback func(content string, done bool)) (string, []ToolCall, error) {
+	var fullResponse strings.Builder
+	var toolCalls []ToolCall
+
+	for chunk := range stream {
+		if chunk.Error != nil {
+			return fullResponse.String(), nil, chunk.Error
+		}
+
+		if chunk.Reasoning != "" {
+			recordReasoning(ctx, chunk.Reasoning)
+		}
+
+		fullResponse.WriteString(chunk.Content)
+		if chunk.ToolCalls != nil {
+			toolCalls = chunk.ToolCalls
+		}
+
+		if callback != nil {
+			callback(chunk.Content, chunk.Done)
+		}
+	}
+
+	return fullResponse.String(), toolCalls, nil
+}
+
+// ResponseInfo is filled in by clients that decide where a request goes, such as FallbackClient
+type ResponseInfo struct {
+	ServedBy string // name of the target that produced the response
+	Model    string // model that produced the response
+	Cached   bool   // the response came from the response cache
+	Usage    Usage  // summed over all calls made with the context, zero if the provider doesn't report it
+
+	Reasoning   string             // thinking of reasoning models, kept out of the response
+	OnReasoning func(chunk string) // called for each chunk of reasoning as it streams, if set
+}
+
+// Usage is the token usage reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type responseInfoKey struct{}
+
+// WithResponseInfo attaches a ResponseInfo to the context for the clients handling the request to fill in
+func WithResponseInfo(ctx context.Context) (context.Context, *ResponseInfo) {
+	info := &ResponseInfo{}
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+func responseInfoFromContext(ctx context.Context) *ResponseInfo {
+	info, _ := ctx.Value(responseInfoKey{}).(*ResponseInfo)
+	return info
+}
+
+// recordUsage adds the usage of a call to the ResponseInfo of the context, if any
+func recordUsage(ctx context.Context, usage Usage) {
+	if info := responseInfoFromContext(ctx); info != nil {
+		info.Usage.PromptTokens += usage.PromptTokens
+		info.Usage.CompletionTokens += usage.CompletionTokens
+	}
+}
+
+// recordReasoning adds reasoning to the ResponseInfo of the context, if any
+func recordReasoning(ctx context.Context, reasoning string) {
+	if info := responseInfoFromContext(ctx); info != nil {
+		info.Reasoning += reasoning
+		if info.OnReasoning != nil {
+			info.OnReasoning(reasoning)
+		}
+	}
 }
@@ -0,0 +1,270 @@
+// Package llmtest provides a fake OpenAI-compatible chat completions server for tests. Responses are scripted
+// in advance, including broken ones, and every request the server receives is recorded for assertions.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Response is a scripted reply. A response with Chunks is sent as an SSE stream, otherwise Body is sent as is.
+type Response struct {
+	Status     int // defaults to 200
+	Header     map[string]string
+	Body       string
+	Chunks     []string      // written and flushed one at a time, so a chunk can end in the middle of a line
+	ChunkDelay time.Duration // wait before every chunk, to simulate slow tokens
+	Abort      bool          // drop the connection after the chunks instead of ending the stream
+}
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Raw    []byte
+	Body   map[string]any // nil if the body isn't a JSON object
+}
+
+// String describes the request for test failure messages
+func (r Request) String() string {
+	return fmt.Sprintf("%s %s %s", r.Method, r.Path, r.Raw)
+}
+
+// Decode unmarshals the request body into v
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Raw, v)
+}
+
+// Messages returns the chat messages of the request
+func (r Request) Messages() []map[string]any {
+	var body struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	_ = r.Decode(&body)
+	return body.Messages
+}
+
+// Server serves the scripted responses in order, one per request, and fails the test if it runs out
+type Server struct {
+	*httptest.Server
+
+	t         testing.TB
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+// NewServer starts a server with the given responses. It is closed when the test ends.
+func NewServer(t testing.TB, responses ...Response) *Server {
+	t.Helper()
+
+	s := &Server{t: t, responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Endpoint returns the chat completions URL of the server
+func (s *Server) Endpoint() string {
+	return s.URL + "/v1/chat/completions"
+}
+
+// Enqueue adds responses to serve after the ones already scripted
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the latest request, failing the test if there was none
+func (s *Server) LastRequest() Request {
+	s.t.Helper()
+
+	requests := s.Requests()
+	if len(requests) == 0 {
+		s.t.Fatal("llmtest: no requests received")
+	}
+
+	return requests[len(requests)-1]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	request := Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Raw: raw}
+	_ = json.Unmarshal(raw, &request.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	if len(s.responses) == 0 {
+		s.mu.Unlock()
+		s.t.Errorf("llmtest: unexpected request %d, no responses left", len(s.Requests()))
+		http.Error(w, "no scripted response", http.StatusInternalServerError)
+		return
+	}
+
+	response := s.responses[0]
+	s.responses = s.responses[1:]
+	s.mu.Unlock()
+
+	for key, value := range response.Header {
+		w.Header().Set(key, value)
+	}
+
+	if response.Chunks == nil {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+
+		w.WriteHeader(max(response.Status, http.StatusOK))
+		_, _ = io.WriteString(w, response.Body)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(max(response.Status, http.StatusOK))
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range response.Chunks {
+		if response.ChunkDelay > 0 {
+			select {
+			case <-time.After(response.ChunkDelay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		_, _ = io.WriteString(w, chunk)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if response.Abort {
+		// Makes the server close the connection without terminating the chunked body
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Completion is a non-streaming response with the given content
+func Completion(content string) Response {
+	return JSON(map[string]any{
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       map[string]any{"role": "assistant", "content": content},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+// JSON is a 200 response with the value encoded as the body
+func JSON(v any) Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return Response{Body: string(body)}
+}
+
+// Error is a non-200 response with the given body
+func Error(status int, body string) Response {
+	return Response{Status: status, Body: body}
+}
+
+// Stream is a streamed response sending one content delta per token, followed by [DONE]
+func Stream(tokens ...string) Response {
+	chunks := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		chunks = append(chunks, Delta(token))
+	}
+
+	return Response{Chunks: append(chunks, Done())}
+}
+
+// Event formats a value as an SSE data event
+func Event(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return "data: " + string(data) + "\n\n"
+}
+
+func deltaEvent(delta map[string]any) string {
+	return Event(map[string]any{
+		"choices": []map[string]any{{"index": 0, "delta": delta}},
+	})
+}
+
+// Delta is a stream event with a content delta
+func Delta(content string) string {
+	return deltaEvent(map[string]any{"content": content})
+}
+
+// ReasoningDelta is a stream event with a reasoning_content delta, as sent by DeepSeek and vLLM
+func ReasoningDelta(reasoning string) string {
+	return deltaEvent(map[string]any{"reasoning_content": reasoning})
+}
+
+// ToolCallDelta is a stream event with part of a tool call. The ID and name are only sent in the first part.
+func ToolCallDelta(index int, id string, name string, arguments string) string {
+	call := map[string]any{
+		"index":    index,
+		"function": map[string]any{"arguments": arguments},
+	}
+
+	if id != "" {
+		call["id"] = id
+		call["type"] = "function"
+		call["function"].(map[string]any)["name"] = name
+	}
+
+	return deltaEvent(map[string]any{"tool_calls": []map[string]any{call}})
+}
+
+// UsageEvent is the final stream event with the token usage and no choices
+func UsageEvent(promptTokens int, completionTokens int) string {
+	return Event(map[string]any{
+		"choices": []any{},
+		"usage": map[string]any{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+}
+
+// Done is the event that ends a stream
+func Done() string {
+	return "data: [DONE]\n\n"
+}
+
+// Split cuts the events into pieces of at most size bytes, so lines and JSON arrive across several writes
+func Split(size int, events ...string) []string {
+	joined := strings.Join(events, "")
+	pieces := make([]string, 0, len(joined)/size+1)
+	for len(joined) > size {
+		pieces = append(pieces, joined[:size])
+		joined = joined[size:]
+	}
+
+	return append(pieces, joined)
+}
@@ -0,0 +1,320 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultOllamaEndpoint = "http://localhost:11434/api/chat"
+
+type OllamaClient struct {
+	Endpoint string
+	Defaults config.OllamaModelOptions
+	Models   map[string]config.OllamaModelOptions
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   map[string]any  `json:"options,omitempty"`
+	Format    map[string]any  `json:"format,omitempty"` // JSON schema the response has to match
+}
+
+// OllamaResponse is both the non-streaming response and a single NDJSON line of a streaming one
+type OllamaResponse struct {
+	Message struct {
+		Content  string `json:"content"`
+		Thinking string `json:"thinking"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"` // only on the last chunk
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// usage returns the token counts of the final response
+func (r *OllamaResponse) usage() Usage {
+	return Usage{PromptTokens: r.PromptEvalCount, CompletionTokens: r.EvalCount}
+}
+
+func NewOllamaClient(endpoint string, defaults config.OllamaModelOptions, models map[string]config.OllamaModelOptions) *OllamaClient {
+	if endpoint == "" {
+		endpoint = DefaultOllamaEndpoint
+	}
+
+	provider := &OllamaClient{
+		Endpoint: endpoint,
+		Defaults: defaults,
+		Models:   models,
+	}
+
+	return provider
+}
+
+// modelOptions returns the defaults overlaid with the per-model overrides for the given model
+func (c *OllamaClient) modelOptions(model string) config.OllamaModelOptions {
+	options := c.Defaults
+	override, ok := c.Models[model]
+	if !ok {
+		return options
+	}
+
+	if override.KeepAlive != "" {
+		options.KeepAlive = override.KeepAlive
+	}
+	if override.NumCtx != 0 {
+		options.NumCtx = override.NumCtx
+	}
+	if override.NumPredict != 0 {
+		options.NumPredict = override.NumPredict
+	}
+	if override.RepeatPenalty != 0 {
+		options.RepeatPenalty = override.RepeatPenalty
+	}
+	if override.Temperature != nil {
+		options.Temperature = override.Temperature
+	}
+
+	return options
+}
+
+func (c *OllamaClient) newRequest(ctx context.Context, request Request, stream bool, format map[string]any) (*http.Request, error) {
+	messages := []ollamaMessage{{Role: "system", Content: request.System}}
+	for _, item := range request.History {
+		if item.Content == "" {
+			continue
+		}
+
+		role := "user"
+		if item.IsBotMessage {
+			role = "assistant"
+		}
+
+		messages = append(messages, ollamaMessage{Role: role, Content: item.Content})
+	}
+
+	messages = append(messages, ollamaMessage{Role: "user", Content: request.Message})
+
+	modelOptions := c.modelOptions(request.Model)
+	options := make(map[string]any)
+	if modelOptions.NumCtx != 0 {
+		options["num_ctx"] = modelOptions.NumCtx
+	}
+	if modelOptions.NumPredict != 0 {
+		options["num_predict"] = modelOptions.NumPredict
+	}
+	if modelOptions.RepeatPenalty != 0 {
+		options["repeat_penalty"] = modelOptions.RepeatPenalty
+	}
+	if modelOptions.Temperature != nil {
+		options["temperature"] = *modelOptions.Temperature
+	}
+
+	// Options of the request override the configured ones
+	if request.Temperature != nil {
+		options["temperature"] = *request.Temperature
+	}
+	if request.TopP != nil {
+		options["top_p"] = *request.TopP
+	}
+	if request.MaxTokens > 0 {
+		options["num_predict"] = request.MaxTokens
+	}
+	if len(request.Stop) > 0 {
+		options["stop"] = request.Stop
+	}
+	if request.Seed != nil {
+		options["seed"] = *request.Seed
+	}
+
+	requestBody := ollamaRequest{
+		Model:     request.Model,
+		Messages:  messages,
+		Stream:    stream,
+		KeepAlive: modelOptions.KeepAlive,
+		Options:   options,
+		Format:    format,
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	zap.L().Debug("ollama request", zap.Bool("stream", stream), zap.String("body", string(jsonBody)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	return req, nil
+}
+
+// ollamaError classifies a failed response like the other providers, keeping only the message of an Ollama error body
+func ollamaError(resp *http.Response, body []byte) error {
+	apiErr := newAPIError(resp, body)
+	var errResp OllamaResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		apiErr.Body = errResp.Error
+	}
+
+	return apiErr
+}
+
+func (c *OllamaClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	req, err := c.newRequest(ctx, request, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Loading a large model into memory can take a while before the first token
+	client := &http.Client{Timeout: 600 * time.Second}
+
+	go func() {
+		defer close(responseChan)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			zap.L().Error("ollama stream request failed", zap.Error(err))
+			responseChan <- StreamResponse{Error: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			responseChan <- StreamResponse{Error: ollamaError(resp, body)}
+			return
+		}
+
+		think := newThinkSplitter(request.Model)
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				responseChan <- StreamResponse{Error: err}
+				return
+			}
+
+			// The last line may come without a trailing newline, so it is parsed before checking for EOF
+			data := strings.TrimSpace(line)
+			if data != "" {
+				var chunk OllamaResponse
+				if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+					zap.L().Error("failed to unmarshal ollama stream chunk", zap.Error(jsonErr), zap.String("data", data))
+				} else if chunk.Error != "" {
+					responseChan <- StreamResponse{Error: errors.New(chunk.Error)}
+					return
+				} else {
+					if chunk.Message.Thinking != "" {
+						think.reasoningSeparated()
+					}
+
+					content, reasoning := think.feed(chunk.Message.Content)
+					if chunk.Done {
+						restContent, restReasoning := think.flush()
+						content, reasoning = content+restContent, reasoning+restReasoning
+						recordUsage(ctx, chunk.usage())
+					}
+
+					responseChan <- StreamResponse{Content: content, Reasoning: chunk.Message.Thinking + reasoning, Done: chunk.Done}
+					if chunk.Done {
+						return
+					}
+				}
+			}
+
+			if err == io.EOF {
+				break
+			}
+		}
+
+		responseChan <- StreamResponse{Done: true}
+	}()
+
+	return responseChan, nil
+}
+
+func (c *OllamaClient) Infer(ctx context.Context, request Request) (string, error) {
+	return c.infer(ctx, request, nil)
+}
+
+// InferJSON constrains the response to the schema with Ollama's structured outputs
+func (c *OllamaClient) InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error) {
+	return c.infer(ctx, request, schema.Schema)
+}
+
+func (c *OllamaClient) infer(ctx context.Context, request Request, format map[string]any) (string, error) {
+	req, err := c.newRequest(ctx, request, false, format)
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 600 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		zap.L().Error("ollama request failed", zap.Error(err))
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", ollamaError(resp, body)
+	}
+
+	var result OllamaResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	if result.Error != "" {
+		return "", errors.New(result.Error)
+	}
+
+	recordUsage(ctx, result.usage())
+
+	content, reasoning := splitThink(result.Message.Content)
+	if reasoning = result.Message.Thinking + reasoning; reasoning != "" {
+		recordReasoning(ctx, reasoning)
+	}
+
+	return content, nil
+}
+
+// InferWithStream is a convenience method that collects all streaming chunks into a single response
+func (c *OllamaClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	stream, err := c.InferStream(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	response, _, err := collectStream(ctx, stream, callback)
+	return response, err
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func ollamaLine(v map[string]any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(data) + "\n"
+}
+
+func ollamaChunk(content string) string {
+	return ollamaLine(map[string]any{"message": map[string]any{"role": "assistant", "content": content}, "done": false})
+}
+
+func TestOllamaStream(t *testing.T) {
+	final := ollamaLine(map[string]any{"message": map[string]any{"role": "assistant", "content": "!"}, "done": true, "done_reason": "stop", "prompt_eval_count": 20, "eval_count": 3})
+
+	tests := []struct {
+		name   string
+		chunks []string
+	}{
+		{name: "one line per chunk", chunks: []string{ollamaChunk("Hello"), ollamaChunk(", world"), final}},
+		{name: "lines split across chunks", chunks: llmtest.Split(7, ollamaChunk("Hello"), ollamaChunk(", world"), final)},
+		// The last line may come without a trailing newline
+		{name: "no trailing newline", chunks: []string{ollamaChunk("Hello"), ollamaChunk(", world"), final[:len(final)-1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, llmtest.Response{Chunks: tt.chunks})
+			client := NewOllamaClient(server.URL+"/api/chat", config.OllamaModelOptions{}, nil)
+
+			ctx, info := WithResponseInfo(context.Background())
+			response, err := client.InferWithStream(ctx, testRequest(), nil)
+			if err != nil {
+				t.Fatalf("InferWithStream: %v", err)
+			}
+
+			if response != "Hello, world!" {
+				t.Errorf("response = %q, want %q", response, "Hello, world!")
+			}
+
+			if info.Usage.PromptTokens != 20 || info.Usage.CompletionTokens != 3 {
+				t.Errorf("usage = %+v, want 20 prompt and 3 completion tokens", info.Usage)
+			}
+		})
+	}
+}
+
+func TestOllamaStreamError(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: []string{
+		ollamaChunk("Partial"),
+		ollamaLine(map[string]any{"error": "model runner has unexpectedly stopped"}),
+	}})
+	client := NewOllamaClient(server.URL+"/api/chat", config.OllamaModelOptions{}, nil)
+
+	_, err := client.InferWithStream(context.Background(), testRequest(), nil)
+	if err == nil || err.Error() != "model runner has unexpectedly stopped" {
+		t.Errorf("error = %v, want the stream error", err)
+	}
+}
+
+func TestOllamaAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+		want     error
+		message  string
+	}{
+		{"server error", llmtest.Error(http.StatusInternalServerError, `{"error":"model runner has unexpectedly stopped"}`), ErrServer, "model runner has unexpectedly stopped"},
+		{"context length", llmtest.Error(http.StatusBadRequest, `{"error":"input exceeds maximum context length"}`), ErrContextLength, "maximum context length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := llmtest.NewServer(t, tt.response, tt.response)
+			client := NewOllamaClient(server.URL+"/api/chat", config.OllamaModelOptions{}, nil)
+
+			_, err := client.Infer(context.Background(), testRequest())
+			_, streamErr := client.InferWithStream(context.Background(), testRequest(), nil)
+			for _, err := range []error{err, streamErr} {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("error = %v, want an APIError of kind %v with %q", err, tt.want, tt.message)
+				}
+			}
+		})
+	}
+}
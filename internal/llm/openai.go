@@ -2,7 +2,6 @@ package llm
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"discord-military-analyst-bot/internal/config"
 	"encoding/json"
@@ -16,38 +15,57 @@ import (
 )
 
 type OpenAIClient struct {
-	Endpoint string
-	Token    string
+	Endpoint    string
+	Token       string
+	Temperature float64 // used when the request doesn't set one
+	Retry       RetryPolicy
+	Vision      config.VisionConfig // whether and which image attachments are sent, off unless set
 }
 
 type OpenAIResponse struct {
 	Choices []struct {
 		Message struct {
-			Content string `json:"content"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			Reasoning        string `json:"reasoning"`
 		} `json:"message"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage"`
 }
 
 type OpenAIStreamResponse struct {
 	Choices []struct {
 		Delta struct {
-			Content string `json:"content"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"` // DeepSeek, vLLM
+			Reasoning        string `json:"reasoning"`         // Ollama, OpenRouter
+			ToolCalls        []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
 		} `json:"delta"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage"` // only on the last chunk, which has no choices
 }
 
-func NewOpenAIClient(endpoint string, token string) *OpenAIClient {
+func NewOpenAIClient(endpoint string, token string, temperature float64, retry RetryPolicy) *OpenAIClient {
 	provider := &OpenAIClient{
-		Endpoint: endpoint,
-		Token:    token,
+		Endpoint:    endpoint,
+		Token:       token,
+		Temperature: temperature,
+		Retry:       retry,
 	}
 
 	return provider
 }
 
-func (c *OpenAIClient) InferStream(ctx context.Context, model string, system string, message string, history []HistoryItem) (<-chan StreamResponse, error) {
-	responseChan := make(chan StreamResponse)
-
+// buildMessages converts the system prompt, history and request into chat messages. Image attachments are sent
+// as image_url content parts when the client's vision settings enable them.
+func (c *OpenAIClient) buildMessages(ctx context.Context, system string, message string, history []HistoryItem, steps []HistoryItem) []map[string]any {
 	messages := make([]map[string]any, 0)
 	systemMessage := map[string]any{
 		"role":    "system",
@@ -55,8 +73,14 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 	}
 
 	messages = append(messages, systemMessage)
-	for _, item := range history {
-		if item.Content == "" {
+	images := selectImages(c.Vision, history)
+	for i, item := range history {
+		var parts []map[string]any
+		if len(images[i]) > 0 {
+			parts = imageParts(ctx, c.Vision, images[i])
+		}
+
+		if item.Content == "" && len(parts) == 0 {
 			continue
 		}
 
@@ -70,6 +94,14 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 			"content": item.Content,
 		}
 
+		if len(parts) > 0 {
+			if item.Content != "" {
+				parts = append([]map[string]any{{"type": "text", "text": item.Content}}, parts...)
+			}
+
+			historyMessage["content"] = parts
+		}
+
 		messages = append(messages, historyMessage)
 	}
 
@@ -79,11 +111,106 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 	}
 
 	messages = append(messages, contentMessage)
+	for _, step := range steps {
+		messages = append(messages, openAIStepMessage(step))
+	}
+
+	return messages
+}
+
+// openAIStepMessage converts a tool call or tool result of the agent loop into a chat message
+func openAIStepMessage(step HistoryItem) map[string]any {
+	if step.ToolCallID != "" {
+		return map[string]any{
+			"role":         "tool",
+			"tool_call_id": step.ToolCallID,
+			"content":      step.Content,
+		}
+	}
+
+	stepMessage := map[string]any{
+		"role":    "assistant",
+		"content": step.Content,
+	}
+
+	if len(step.ToolCalls) > 0 {
+		toolCalls := make([]map[string]any, 0, len(step.ToolCalls))
+		for _, call := range step.ToolCalls {
+			toolCalls = append(toolCalls, map[string]any{
+				"id":   call.ID,
+				"type": "function",
+				"function": map[string]any{
+					"name":      call.Name,
+					"arguments": call.Arguments,
+				},
+			})
+		}
+
+		stepMessage["tool_calls"] = toolCalls
+	}
+
+	return stepMessage
+}
+
+// openAITools converts tools into function definitions for the request
+func openAITools(tools []Tool) []map[string]any {
+	definitions := make([]map[string]any, 0, len(tools))
+	for _, tool := range tools {
+		definitions = append(definitions, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        tool.Name(),
+				"description": tool.Description(),
+				"parameters":  tool.Parameters(),
+			},
+		})
+	}
+
+	return definitions
+}
+
+// requestBody builds the chat completion request body shared by the streaming and non-streaming calls
+func (c *OpenAIClient) requestBody(ctx context.Context, request Request, steps []HistoryItem) map[string]any {
 	requestBody := map[string]any{
-		"messages":    messages,
-		"model":       model,
-		"stream":      true,
-		"temperature": config.Data.OpenAI.Temperature,
+		"messages":    c.buildMessages(ctx, request.System, request.Message, request.History, steps),
+		"model":       request.Model,
+		"temperature": request.temperature(c.Temperature),
+	}
+
+	if request.TopP != nil {
+		requestBody["top_p"] = *request.TopP
+	}
+	if request.MaxTokens > 0 {
+		requestBody["max_tokens"] = request.MaxTokens
+	}
+	if len(request.Stop) > 0 {
+		requestBody["stop"] = request.Stop
+	}
+	if request.Seed != nil {
+		requestBody["seed"] = *request.Seed
+	}
+	if request.User != "" {
+		requestBody["user"] = request.User
+	}
+
+	return requestBody
+}
+
+func (c *OpenAIClient) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	return c.inferStream(ctx, request, nil, nil)
+}
+
+func (c *OpenAIClient) inferStream(ctx context.Context, request Request, steps []HistoryItem, tools []Tool) (<-chan StreamResponse, error) {
+	responseChan := make(chan StreamResponse)
+
+	requestBody := c.requestBody(ctx, request, steps)
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]any{
+		"include_usage": true,
+	}
+
+	if len(tools) > 0 {
+		requestBody["tools"] = openAITools(tools)
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
@@ -92,21 +219,24 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 	}
 
 	zap.L().Debug("openai stream request", zap.String("body", string(jsonBody)))
-	req, err := http.NewRequestWithContext(ctx, "POST", config.Data.OpenAI.Endpoint, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, err
-	}
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
 
-	req.Header.Set("Authorization", "Bearer "+config.Data.OpenAI.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	}
 
 	client := &http.Client{Timeout: 180 * time.Second}
 
 	go func() {
 		defer close(responseChan)
 
-		resp, err := client.Do(req)
+		resp, err := c.Retry.do(ctx, client, jsonBody, newRequest)
 		if err != nil {
 			zap.L().Error("openai stream request failed", zap.Error(err))
 			responseChan <- StreamResponse{Error: err}
@@ -114,13 +244,8 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 		}
 		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(resp.Body)
-			err := errors.New(string(body))
-			responseChan <- StreamResponse{Error: err}
-			return
-		}
-
+		var toolCalls toolCallAccumulator
+		think := newThinkSplitter(request.Model)
 		reader := bufio.NewReader(resp.Body)
 		for {
 			line, err := reader.ReadString('\n')
@@ -148,54 +273,55 @@ func (c *OpenAIClient) InferStream(ctx context.Context, model string, system str
 				continue
 			}
 
+			if streamResp.Usage != nil {
+				recordUsage(ctx, *streamResp.Usage)
+			}
+
 			if len(streamResp.Choices) > 0 {
-				content := streamResp.Choices[0].Delta.Content
-				responseChan <- StreamResponse{Content: content, Done: false}
+				delta := streamResp.Choices[0].Delta
+				for _, call := range delta.ToolCalls {
+					toolCalls.add(call.Index, call.ID, call.Function.Name, call.Function.Arguments)
+				}
+
+				if delta.ReasoningContent != "" || delta.Reasoning != "" {
+					think.reasoningSeparated()
+				}
+
+				content, reasoning := think.feed(delta.Content)
+				reasoning = delta.ReasoningContent + delta.Reasoning + reasoning
+				if content != "" || reasoning != "" {
+					responseChan <- StreamResponse{Content: content, Reasoning: reasoning, Done: false}
+				}
 			}
 		}
 
-		responseChan <- StreamResponse{Done: true}
+		content, reasoning := think.flush()
+		responseChan <- StreamResponse{Content: content, Reasoning: reasoning, Done: true, ToolCalls: toolCalls.result()}
 	}()
 
 	return responseChan, nil
 }
 
-func (c *OpenAIClient) Infer(ctx context.Context, model string, system string, message string, history []HistoryItem) (string, error) {
-	messages := make([]map[string]any, 0)
-	systemMessage := map[string]any{
-		"role":    "system",
-		"content": system,
-	}
-
-	messages = append(messages, systemMessage)
-	for _, item := range history {
-		if item.Content == "" {
-			continue
-		}
-
-		role := "user"
-		if item.IsBotMessage {
-			role = "assistant"
-		}
-
-		historyMessage := map[string]any{
-			"role":    role,
-			"content": item.Content,
-		}
-
-		messages = append(messages, historyMessage)
-	}
+func (c *OpenAIClient) Infer(ctx context.Context, request Request) (string, error) {
+	return c.infer(ctx, request, nil)
+}
 
-	contentMessage := map[string]any{
-		"role":    "user",
-		"content": message,
-	}
+// InferJSON constrains the response to the schema with a json_schema response format
+func (c *OpenAIClient) InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error) {
+	return c.infer(ctx, request, map[string]any{
+		"type": "json_schema",
+		"json_schema": map[string]any{
+			"name":   schema.Name,
+			"schema": schema.Schema,
+			"strict": schema.Strict,
+		},
+	})
+}
 
-	messages = append(messages, contentMessage)
-	requestBody := map[string]any{
-		"messages":    messages,
-		"model":       model,
-		"temperature": config.Data.OpenAI.Temperature,
+func (c *OpenAIClient) infer(ctx context.Context, request Request, responseFormat map[string]any) (string, error) {
+	requestBody := c.requestBody(ctx, request, nil)
+	if responseFormat != nil {
+		requestBody["response_format"] = responseFormat
 	}
 
 	jsonBody, err := json.Marshal(requestBody)
@@ -204,16 +330,19 @@ func (c *OpenAIClient) Infer(ctx context.Context, model string, system string, m
 	}
 
 	zap.L().Debug("openai request", zap.String("body", string(jsonBody)))
-	req, err := http.NewRequestWithContext(ctx, "POST", config.Data.OpenAI.Endpoint, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return "", err
-	}
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
 
-	req.Header.Set("Authorization", "Bearer "+config.Data.OpenAI.ApiKey)
-	req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
 
 	client := &http.Client{Timeout: 180 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.Retry.do(ctx, client, jsonBody, newRequest)
 	if err != nil {
 		zap.L().Error("openai request failed", zap.Error(err))
 		return "", err
@@ -224,37 +353,46 @@ func (c *OpenAIClient) Infer(ctx context.Context, model string, system string, m
 	if err != nil {
 		return "", err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return "", errors.New(string(body))
-	}
 
 	var result OpenAIResponse
 	if err := json.Unmarshal(body, &result); err != nil {
 		return "", err
 	}
 
-	return result.Choices[0].Message.Content, nil
+	if result.Usage != nil {
+		recordUsage(ctx, *result.Usage)
+	}
+
+	if len(result.Choices) == 0 {
+		return "", errors.New("openai response has no choices")
+	}
+
+	choice := result.Choices[0].Message
+	content, reasoning := splitThink(choice.Content)
+	if reasoning = choice.ReasoningContent + choice.Reasoning + reasoning; reasoning != "" {
+		recordReasoning(ctx, reasoning)
+	}
+
+	return content, nil
 }
 
 // InferWithStream is a convenience method that collects all streaming chunks into a single response
-func (c *OpenAIClient) InferWithStream(ctx context.Context, model string, system string, message string, history []HistoryItem, callback func(content string, done bool)) (string, error) {
-	stream, err := c.InferStream(ctx, model, system, message, history)
+func (c *OpenAIClient) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	stream, err := c.InferStream(ctx, request)
 	if err != nil {
 		return "", err
 	}
 
-	var fullResponse strings.Builder
-
-	for chunk := range stream {
-		if chunk.Error != nil {
-			return fullResponse.String(), chunk.Error
-		}
+	response, _, err := collectStream(ctx, stream, callback)
+	return response, err
+}
 
-		fullResponse.WriteString(chunk.Content)
-		if callback != nil {
-			callback(chunk.Content, chunk.Done)
-		}
+// InferWithTools streams a single step of a tool-using conversation, returning the tool calls the model asked for
+func (c *OpenAIClient) InferWithTools(ctx context.Context, request Request, steps []HistoryItem, tools []Tool, callback func(content string, done bool)) (string, []ToolCall, error) {
+	stream, err := c.inferStream(ctx, request, steps, tools)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return fullResponse.String(), nil
+	return collectStream(ctx, stream, callback)
 }
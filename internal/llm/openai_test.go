@@ -0,0 +1,510 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"discord-military-analyst-bot/internal/config"
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestMain(m *testing.M) {
+	// Parts of the client read the global config, which is normally loaded from app.env
+	config.Data = &config.Config{}
+	os.Exit(m.Run())
+}
+
+var testRetry = RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func newTestClient(server *llmtest.Server) *OpenAIClient {
+	return NewOpenAIClient(server.Endpoint(), "test-token", 0.7, testRetry)
+}
+
+func testRequest() Request {
+	return Request{
+		Model:   "test-model",
+		System:  "You are a test.",
+		Message: "What is up?",
+		History: []HistoryItem{
+			{Content: "Earlier question"},
+			{Content: "Earlier answer", IsBotMessage: true},
+			{Content: ""},
+		},
+	}
+}
+
+type fakeTool struct{}
+
+func (fakeTool) Name() string               { return "lookup" }
+func (fakeTool) Description() string        { return "Looks things up" }
+func (fakeTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (fakeTool) Execute(ctx context.Context, arguments string) (string, error) {
+	return "", nil
+}
+
+func TestOpenAIInfer(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Completion("Not much."))
+
+	response, err := newTestClient(server).Infer(context.Background(), testRequest())
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if response != "Not much." {
+		t.Errorf("response = %q, want %q", response, "Not much.")
+	}
+
+	request := server.LastRequest()
+	if got := request.Header.Get("Authorization"); got != "Bearer test-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if request.Body["model"] != "test-model" || request.Body["temperature"] != 0.7 {
+		t.Errorf("unexpected request %s", request)
+	}
+	if _, ok := request.Body["stream"]; ok {
+		t.Errorf("non-streaming request has stream set: %s", request)
+	}
+
+	messages := request.Messages()
+	wantRoles := []string{"system", "user", "assistant", "user"}
+	if len(messages) != len(wantRoles) {
+		t.Fatalf("got %d messages, want %d: %s", len(messages), len(wantRoles), request)
+	}
+	for i, role := range wantRoles {
+		if messages[i]["role"] != role {
+			t.Errorf("message %d role = %v, want %s", i, messages[i]["role"], role)
+		}
+	}
+	if messages[3]["content"] != "What is up?" {
+		t.Errorf("last message = %v", messages[3]["content"])
+	}
+}
+
+func TestOpenAIInferSamplingOptions(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Completion("ok"))
+
+	temperature, topP, seed := 0.1, 0.9, 42
+	request := testRequest()
+	request.Temperature = &temperature
+	request.TopP = &topP
+	request.Seed = &seed
+	request.MaxTokens = 100
+	request.Stop = []string{"END"}
+	request.User = "user-1"
+
+	if _, err := newTestClient(server).Infer(context.Background(), request); err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	var body struct {
+		Temperature float64  `json:"temperature"`
+		TopP        float64  `json:"top_p"`
+		Seed        int      `json:"seed"`
+		MaxTokens   int      `json:"max_tokens"`
+		Stop        []string `json:"stop"`
+		User        string   `json:"user"`
+	}
+	if err := server.LastRequest().Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Temperature != 0.1 || body.TopP != 0.9 || body.Seed != 42 || body.MaxTokens != 100 ||
+		len(body.Stop) != 1 || body.Stop[0] != "END" || body.User != "user-1" {
+		t.Errorf("sampling options not sent: %+v", body)
+	}
+}
+
+func TestOpenAIInferUsageAndReasoning(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{
+		"choices": []map[string]any{{
+			"message": map[string]any{"content": "<think>Let me see.</think>The answer."},
+		}},
+		"usage": map[string]any{"prompt_tokens": 12, "completion_tokens": 5},
+	}))
+
+	ctx, info := WithResponseInfo(context.Background())
+	response, err := newTestClient(server).Infer(ctx, testRequest())
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	if response != "The answer." {
+		t.Errorf("response = %q", response)
+	}
+	if info.Reasoning != "Let me see." {
+		t.Errorf("reasoning = %q", info.Reasoning)
+	}
+	if info.Usage != (Usage{PromptTokens: 12, CompletionTokens: 5}) {
+		t.Errorf("usage = %+v", info.Usage)
+	}
+}
+
+func TestOpenAIInferNoChoices(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{"choices": []any{}}))
+
+	if _, err := newTestClient(server).Infer(context.Background(), testRequest()); err == nil {
+		t.Error("expected an error for a response without choices")
+	}
+}
+
+func TestOpenAIInferJSON(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Completion(`{"ok":true}`))
+
+	schema := JSONSchema{Name: "result", Schema: map[string]any{"type": "object"}, Strict: true}
+	response, err := newTestClient(server).InferJSON(context.Background(), testRequest(), schema)
+	if err != nil {
+		t.Fatalf("InferJSON: %v", err)
+	}
+	if response != `{"ok":true}` {
+		t.Errorf("response = %q", response)
+	}
+
+	var body struct {
+		ResponseFormat struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Name   string `json:"name"`
+				Strict bool   `json:"strict"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := server.LastRequest().Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ResponseFormat.Type != "json_schema" || body.ResponseFormat.JSONSchema.Name != "result" || !body.ResponseFormat.JSONSchema.Strict {
+		t.Errorf("response_format = %+v", body.ResponseFormat)
+	}
+}
+
+func TestOpenAIInferErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response llmtest.Response
+		want     error
+		requests int
+	}{
+		{"unauthorized", llmtest.Error(http.StatusUnauthorized, `{"error":{"message":"bad key"}}`), ErrUnauthorized, 1},
+		{"context length", llmtest.Error(http.StatusBadRequest, `{"error":{"code":"context_length_exceeded"}}`), ErrContextLength, 1},
+		{"server error", llmtest.Error(http.StatusBadGateway, "upstream down"), ErrServer, testRetry.Attempts},
+		{"rate limited", llmtest.Error(http.StatusTooManyRequests, "slow down"), ErrRateLimited, testRetry.Attempts},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := llmtest.NewServer(t)
+			for range test.requests {
+				server.Enqueue(test.response)
+			}
+
+			_, err := newTestClient(server).Infer(context.Background(), testRequest())
+			if !errors.Is(err, test.want) {
+				t.Errorf("error = %v, want %v", err, test.want)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != max(test.response.Status, http.StatusOK) {
+				t.Errorf("error = %#v, want an APIError with status %d", err, test.response.Status)
+			}
+
+			if got := len(server.Requests()); got != test.requests {
+				t.Errorf("got %d requests, want %d", got, test.requests)
+			}
+		})
+	}
+}
+
+func TestOpenAIInferRetriesThenSucceeds(t *testing.T) {
+	server := llmtest.NewServer(t,
+		llmtest.Error(http.StatusServiceUnavailable, "overloaded"),
+		llmtest.Response{Status: http.StatusTooManyRequests, Header: map[string]string{"Retry-After": "0"}},
+		llmtest.Completion("finally"),
+	)
+
+	response, err := newTestClient(server).Infer(context.Background(), testRequest())
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+	if response != "finally" {
+		t.Errorf("response = %q", response)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(requests))
+	}
+	if string(requests[0].Raw) != string(requests[2].Raw) {
+		t.Error("retried request body differs from the first one")
+	}
+}
+
+func TestOpenAIInferRetryAfterTooLong(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{
+		Status: http.StatusTooManyRequests,
+		Header: map[string]string{"Retry-After": "120"},
+	})
+
+	_, err := newTestClient(server).Infer(context.Background(), testRequest())
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("error = %v, want %v", err, ErrRateLimited)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+// streamChunks collects the callback calls of a streamed inference
+type streamChunks struct {
+	contents []string
+	done     int
+}
+
+func (s *streamChunks) callback(content string, done bool) {
+	if content != "" {
+		s.contents = append(s.contents, content)
+	}
+	if done {
+		s.done++
+	}
+}
+
+func TestOpenAIInferWithStream(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Stream("Hel", "lo", " there"))
+
+	var chunks streamChunks
+	response, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), chunks.callback)
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+
+	if response != "Hello there" {
+		t.Errorf("response = %q", response)
+	}
+	if strings.Join(chunks.contents, "|") != "Hel|lo| there" {
+		t.Errorf("chunks = %q", chunks.contents)
+	}
+	if chunks.done != 1 {
+		t.Errorf("done reported %d times, want 1", chunks.done)
+	}
+
+	var body struct {
+		Stream        bool `json:"stream"`
+		StreamOptions struct {
+			IncludeUsage bool `json:"include_usage"`
+		} `json:"stream_options"`
+	}
+	if err := server.LastRequest().Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Stream || !body.StreamOptions.IncludeUsage {
+		t.Errorf("stream options not sent: %+v", body)
+	}
+}
+
+func TestOpenAIStreamSplitLines(t *testing.T) {
+	events := []string{llmtest.Delta("Split "), llmtest.Delta("across "), llmtest.Delta("writes"), llmtest.Done()}
+	for _, size := range []int{1, 7, 50} {
+		server := llmtest.NewServer(t, llmtest.Response{Chunks: llmtest.Split(size, events...)})
+
+		response, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), nil)
+		if err != nil {
+			t.Fatalf("size %d: InferWithStream: %v", size, err)
+		}
+		if response != "Split across writes" {
+			t.Errorf("size %d: response = %q", size, response)
+		}
+	}
+}
+
+func TestOpenAIStreamSkipsMalformedEvents(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: []string{
+		llmtest.Delta("Good "),
+		"data: {\"choices\": [{\"delta\": \n\n",
+		": keep-alive comment\n\n",
+		"event: ping\n\n",
+		llmtest.Delta("still good"),
+		llmtest.Done(),
+	}})
+
+	response, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), nil)
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+	if response != "Good still good" {
+		t.Errorf("response = %q", response)
+	}
+}
+
+func TestOpenAIStreamAbortedMidStream(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{
+		Chunks: []string{llmtest.Delta("Partial "), llmtest.Delta("answer")},
+		Abort:  true,
+	})
+
+	var chunks streamChunks
+	response, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), chunks.callback)
+	if err == nil {
+		t.Fatal("expected an error when the connection drops mid-stream")
+	}
+	if response != "Partial answer" {
+		t.Errorf("partial response = %q", response)
+	}
+	if chunks.done != 0 {
+		t.Error("done reported for an aborted stream")
+	}
+}
+
+func TestOpenAIStreamNon200(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Error(http.StatusUnauthorized, `{"error":{"message":"bad key"}}`))
+
+	_, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), nil)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestOpenAIStreamSlowTokens(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	server := llmtest.NewServer(t, llmtest.Response{
+		Chunks:     []string{llmtest.Delta("one "), llmtest.Delta("two "), llmtest.Delta("three"), llmtest.Done()},
+		ChunkDelay: delay,
+	})
+
+	var arrivals []time.Time
+	response, err := newTestClient(server).InferWithStream(context.Background(), testRequest(), func(content string, done bool) {
+		if content != "" {
+			arrivals = append(arrivals, time.Now())
+		}
+	})
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+
+	if response != "one two three" {
+		t.Errorf("response = %q", response)
+	}
+	if len(arrivals) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(arrivals))
+	}
+	// Chunks have to be passed on as they arrive instead of after the stream ends
+	if gap := arrivals[2].Sub(arrivals[0]); gap < delay {
+		t.Errorf("chunks arrived %v apart, want at least %v", gap, delay)
+	}
+}
+
+func TestOpenAIStreamCancelled(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{
+		Chunks:     []string{llmtest.Delta("one "), llmtest.Delta("two "), llmtest.Delta("three"), llmtest.Done()},
+		ChunkDelay: 100 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	response, err := newTestClient(server).InferWithStream(ctx, testRequest(), nil)
+	if err == nil {
+		t.Fatal("expected an error when the context is cancelled mid-stream")
+	}
+	if response != "one " {
+		t.Errorf("partial response = %q", response)
+	}
+}
+
+func TestOpenAIStreamReasoningAndUsage(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: []string{
+		llmtest.ReasoningDelta("Field "),
+		llmtest.ReasoningDelta("reasoning. "),
+		llmtest.Delta("<thi"),
+		llmtest.Delta("nk>Inline thoughts.</th"),
+		llmtest.Delta("ink>Answer"),
+		llmtest.Delta(" text"),
+		llmtest.UsageEvent(20, 7),
+		llmtest.Done(),
+	}})
+
+	ctx, info := WithResponseInfo(context.Background())
+	var streamed []string
+	info.OnReasoning = func(chunk string) {
+		streamed = append(streamed, chunk)
+	}
+
+	response, err := newTestClient(server).InferWithStream(ctx, testRequest(), nil)
+	if err != nil {
+		t.Fatalf("InferWithStream: %v", err)
+	}
+
+	if response != "Answer text" {
+		t.Errorf("response = %q", response)
+	}
+	if info.Reasoning != "Field reasoning. Inline thoughts." {
+		t.Errorf("reasoning = %q", info.Reasoning)
+	}
+	if strings.Join(streamed, "") != info.Reasoning {
+		t.Errorf("OnReasoning got %q", streamed)
+	}
+	if info.Usage != (Usage{PromptTokens: 20, CompletionTokens: 7}) {
+		t.Errorf("usage = %+v", info.Usage)
+	}
+}
+
+func TestOpenAIInferWithTools(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Chunks: []string{
+		llmtest.ToolCallDelta(0, "call_1", "lookup", `{"que`),
+		llmtest.ToolCallDelta(0, "", "", `ry":"tanks"}`),
+		llmtest.ToolCallDelta(1, "call_2", "lookup", `{}`),
+		llmtest.Done(),
+	}})
+
+	steps := []HistoryItem{
+		{ToolCalls: []ToolCall{{ID: "call_0", Name: "lookup", Arguments: `{}`}}, IsBotMessage: true},
+		{ToolCallID: "call_0", Content: "earlier result"},
+	}
+
+	_, calls, err := newTestClient(server).InferWithTools(context.Background(), testRequest(), steps, []Tool{fakeTool{}}, nil)
+	if err != nil {
+		t.Fatalf("InferWithTools: %v", err)
+	}
+
+	want := []ToolCall{
+		{ID: "call_1", Name: "lookup", Arguments: `{"query":"tanks"}`},
+		{ID: "call_2", Name: "lookup", Arguments: `{}`},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %+v, want %+v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+
+	request := server.LastRequest()
+	var body struct {
+		Tools []struct {
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	if err := request.Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Tools) != 1 || body.Tools[0].Function.Name != "lookup" {
+		t.Errorf("tools not sent: %s", request)
+	}
+
+	messages := request.Messages()
+	if len(messages) < 2 {
+		t.Fatalf("missing step messages: %s", request)
+	}
+	toolCall, toolResult := messages[len(messages)-2], messages[len(messages)-1]
+	if toolCall["role"] != "assistant" || toolCall["tool_calls"] == nil {
+		t.Errorf("tool call step = %v", toolCall)
+	}
+	if toolResult["role"] != "tool" || toolResult["tool_call_id"] != "call_0" || toolResult["content"] != "earlier result" {
+		t.Errorf("tool result step = %v", toolResult)
+	}
+}
@@ -0,0 +1,164 @@
+package llm
+
+import (
+	"discord-military-analyst-bot/internal/config"
+	"strings"
+	"unicode"
+)
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// thinkSplitter separates inline <think>...</think> spans of reasoning models from the answer in a stream of chunks.
+// A tag split across chunks is held back until the next chunk shows whether it is one. Some chat templates (DeepSeek-R1,
+// QwQ) open the span themselves, so the model only emits the closing tag; for those the stream starts as reasoning, which
+// is held back until the closing tag shows it really is.
+type thinkSplitter struct {
+	thinking   bool
+	afterThink bool // drop the whitespace between the closing tag and the answer
+	pending    string
+
+	implicit bool   // the stream starts inside a thinking span
+	started  bool   // the start of the stream was checked for an explicit opening tag
+	closed   bool   // a closing tag was seen
+	unclosed string // text of an implicit span that isn't closed yet, reasoning once it closes and the answer otherwise
+}
+
+// newThinkSplitter returns a splitter for the model, starting inside a thinking span if the model's template opens it
+func newThinkSplitter(model string) thinkSplitter {
+	model = strings.ToLower(model)
+	for _, pattern := range config.Data.Reasoning.ImplicitThinkModels {
+		if pattern != "" && strings.Contains(model, strings.ToLower(pattern)) {
+			return thinkSplitter{implicit: true}
+		}
+	}
+
+	return thinkSplitter{}
+}
+
+// reasoningSeparated tells the splitter that the server sends the reasoning in its own field, so the content is the
+// answer even for a model that would otherwise start inside a thinking span
+func (s *thinkSplitter) reasoningSeparated() {
+	if !s.started {
+		s.implicit = false
+	}
+}
+
+// feed returns the answer and the reasoning in the chunk
+func (s *thinkSplitter) feed(chunk string) (string, string) {
+	var content, reasoning strings.Builder
+	text := s.pending + chunk
+	s.pending = ""
+
+	if s.implicit && !s.started {
+		// Wait until it is clear whether the model opens the span explicitly anyway
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		if len(trimmed) < len(thinkOpenTag) && strings.HasPrefix(thinkOpenTag, trimmed) {
+			s.pending = text
+			return "", ""
+		}
+
+		s.started = true
+		s.thinking = true
+		text = strings.TrimPrefix(trimmed, thinkOpenTag)
+	}
+
+	for text != "" {
+		tag := thinkOpenTag
+		if s.thinking {
+			tag = thinkCloseTag
+		}
+
+		index := strings.Index(text, tag)
+		if index < 0 {
+			keep := partialTagSuffix(text, tag)
+			s.pending = text[len(text)-keep:]
+			text = text[:len(text)-keep]
+		}
+
+		part := text
+		if index >= 0 {
+			part = text[:index]
+		}
+
+		switch {
+		case s.thinking && s.implicit && !s.closed:
+			// Held back until the span closes, since it is the answer if it never does
+			s.unclosed += part
+		case s.thinking:
+			reasoning.WriteString(part)
+		default:
+			content.WriteString(s.trimAfterThink(part))
+		}
+
+		if index < 0 {
+			break
+		}
+
+		text = text[index+len(tag):]
+		if s.thinking && !s.closed {
+			reasoning.WriteString(s.unclosed)
+			s.unclosed = ""
+			s.closed = true
+		}
+		s.afterThink = s.thinking
+		s.thinking = !s.thinking
+	}
+
+	return content.String(), reasoning.String()
+}
+
+// flush returns whatever was held back at the end of the stream. If an implicit span was never closed, the model
+// didn't think after all and everything it sent is returned as the answer.
+func (s *thinkSplitter) flush() (string, string) {
+	pending := s.pending
+	s.pending = ""
+
+	if s.implicit && !s.closed {
+		return strings.TrimSpace(s.unclosed + pending), ""
+	}
+
+	if s.thinking {
+		return "", pending
+	}
+
+	return s.trimAfterThink(pending), ""
+}
+
+func (s *thinkSplitter) trimAfterThink(text string) string {
+	if !s.afterThink {
+		return text
+	}
+
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	if text != "" {
+		s.afterThink = false
+	}
+
+	return text
+}
+
+// partialTagSuffix returns the length of the longest suffix of text that is a prefix of tag
+func partialTagSuffix(text string, tag string) int {
+	for n := min(len(text), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// splitThink separates the <think> spans of a complete response from the answer. A closing tag without an opening
+// one before it means the template opened the span, so the text before it is reasoning.
+func splitThink(text string) (string, string) {
+	closeIndex := strings.Index(text, thinkCloseTag)
+	openIndex := strings.Index(text, thinkOpenTag)
+	splitter := thinkSplitter{implicit: closeIndex >= 0 && (openIndex < 0 || openIndex > closeIndex)}
+	content, reasoning := splitter.feed(text)
+	restContent, restReasoning := splitter.flush()
+
+	return content + restContent, reasoning + restReasoning
+}
@@ -0,0 +1,61 @@
+package llm
+
+import "testing"
+
+func TestThinkSplitter(t *testing.T) {
+	tests := []struct {
+		name          string
+		implicit      bool
+		chunks        []string
+		wantContent   string
+		wantReasoning string
+	}{
+		{name: "no tags", chunks: []string{"Hello", ", world"}, wantContent: "Hello, world"},
+		{name: "think span", chunks: []string{"<think>hmm</think>\n\nAnswer"}, wantContent: "Answer", wantReasoning: "hmm"},
+		{name: "tags split across chunks", chunks: []string{"<th", "ink>let me", " see</th", "ink>", "\n", "Answer"}, wantContent: "Answer", wantReasoning: "let me see"},
+		{name: "angle bracket that is no tag", chunks: []string{"a <", "b"}, wantContent: "a <b"},
+		{name: "partial tag at the end", chunks: []string{"Answer <thi"}, wantContent: "Answer <thi"},
+		{name: "unclosed span", chunks: []string{"<think>still thinking"}, wantReasoning: "still thinking"},
+		{name: "implicit span", implicit: true, chunks: []string{"hmm, the user", " asks</thi", "nk>\n\nAnswer"}, wantContent: "Answer", wantReasoning: "hmm, the user asks"},
+		{name: "implicit with explicit opener", implicit: true, chunks: []string{"\n<th", "ink>hmm</think>Answer"}, wantContent: "Answer", wantReasoning: "hmm"},
+		{name: "implicit never closed", implicit: true, chunks: []string{"Just", " an answer"}, wantContent: "Just an answer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := thinkSplitter{implicit: tt.implicit}
+			var content, reasoning string
+			for _, chunk := range tt.chunks {
+				c, r := splitter.feed(chunk)
+				content, reasoning = content+c, reasoning+r
+			}
+
+			c, r := splitter.flush()
+			content, reasoning = content+c, reasoning+r
+
+			// An implicit span that is never closed is held back and returned as the answer only
+			if content != tt.wantContent || reasoning != tt.wantReasoning {
+				t.Errorf("content %q, reasoning %q; want %q, %q", content, reasoning, tt.wantContent, tt.wantReasoning)
+			}
+		})
+	}
+}
+
+func TestSplitThink(t *testing.T) {
+	tests := []struct {
+		text          string
+		wantContent   string
+		wantReasoning string
+	}{
+		{"Plain answer", "Plain answer", ""},
+		{"<think>hmm</think> Answer", "Answer", "hmm"},
+		{"hmm, lone closing tag</think>\nAnswer", "Answer", "hmm, lone closing tag"},
+	}
+
+	for _, tt := range tests {
+		content, reasoning := splitThink(tt.text)
+		if content != tt.wantContent || reasoning != tt.wantReasoning {
+			t.Errorf("splitThink(%q) = %q, %q; want %q, %q", tt.text, content, reasoning, tt.wantContent, tt.wantReasoning)
+		}
+	}
+}
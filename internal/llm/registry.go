@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+// Registry routes requests to named providers. The model passed to it can be an alias such as "fast" or "smart",
+// the name of a provider (meaning its default model), or a plain model name for the default provider, so the rest of
+// the bot can ask for a role instead of a hard-coded model.
+type Registry struct {
+	defaultProvider string
+	providers       map[string]registeredProvider
+	aliases         map[string]ModelAlias
+}
+
+type registeredProvider struct {
+	client Client
+	model  string
+}
+
+// ModelAlias maps a role to a provider and a model
+type ModelAlias struct {
+	Provider string
+	Model    string // empty means the provider's default model
+}
+
+func NewRegistry(defaultProvider string) *Registry {
+	return &Registry{
+		defaultProvider: defaultProvider,
+		providers:       make(map[string]registeredProvider),
+		aliases:         make(map[string]ModelAlias),
+	}
+}
+
+// AddProvider registers a client under a name, with the model used when a request doesn't pick one
+func (r *Registry) AddProvider(name string, client Client, defaultModel string) {
+	r.providers[name] = registeredProvider{client: client, model: defaultModel}
+}
+
+// AddAlias registers a role for a provider and model. The provider has to be registered first.
+func (r *Registry) AddAlias(alias string, provider string, model string) error {
+	if _, ok := r.providers[provider]; !ok {
+		return fmt.Errorf("alias %q refers to unknown provider %q", alias, provider)
+	}
+
+	r.aliases[alias] = ModelAlias{Provider: provider, Model: model}
+	return nil
+}
+
+// Provider returns the client registered under the name
+func (r *Registry) Provider(name string) (Client, bool) {
+	provider, ok := r.providers[name]
+	return provider.client, ok
+}
+
+// Resolve returns the provider name, client and model for an alias, a provider name or a plain model name
+func (r *Registry) Resolve(name string) (string, Client, string) {
+	if alias, ok := r.aliases[name]; ok {
+		provider := r.providers[alias.Provider]
+		if alias.Model == "" {
+			return alias.Provider, provider.client, provider.model
+		}
+
+		return alias.Provider, provider.client, alias.Model
+	}
+
+	if provider, ok := r.providers[name]; ok {
+		return name, provider.client, provider.model
+	}
+
+	provider := r.providers[r.defaultProvider]
+	if name == "" {
+		name = provider.model
+	}
+
+	return r.defaultProvider, provider.client, name
+}
+
+// resolve returns the client for the request's model and the request with the model it resolves to
+func (r *Registry) resolve(ctx context.Context, request Request) (Client, Request, error) {
+	providerName, client, model := r.Resolve(request.Model)
+	if client == nil {
+		return nil, request, fmt.Errorf("no provider for model %q", request.Model)
+	}
+
+	// Wrapping clients such as FallbackClient overwrite this with the target that actually answered
+	if info := responseInfoFromContext(ctx); info != nil {
+		info.ServedBy = providerName + "/" + model
+		info.Model = model
+	}
+
+	return client, request.withModel(model), nil
+}
+
+func (r *Registry) Infer(ctx context.Context, request Request) (string, error) {
+	client, request, err := r.resolve(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	return client.Infer(ctx, request)
+}
+
+func (r *Registry) InferStream(ctx context.Context, request Request) (<-chan StreamResponse, error) {
+	client, request, err := r.resolve(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if streamClient, ok := client.(StreamClient); ok {
+		return streamClient.InferStream(ctx, request)
+	}
+
+	responseChan := make(chan StreamResponse)
+	go func() {
+		defer close(responseChan)
+
+		response, err := client.Infer(ctx, request)
+		if err != nil {
+			responseChan <- StreamResponse{Error: err}
+			return
+		}
+
+		responseChan <- StreamResponse{Content: response}
+		responseChan <- StreamResponse{Done: true}
+	}()
+
+	return responseChan, nil
+}
+
+func (r *Registry) InferWithStream(ctx context.Context, request Request, callback func(content string, done bool)) (string, error) {
+	client, request, err := r.resolve(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	return inferStreamOrFallback(ctx, client, request, callback)
+}
+
+// InferWithTools runs the step on the resolved provider. Providers without tool support answer without tools on
+// the first step and fail once tool results have to be passed back.
+func (r *Registry) InferWithTools(ctx context.Context, request Request, steps []HistoryItem, tools []Tool, callback func(content string, done bool)) (string, []ToolCall, error) {
+	client, request, err := r.resolve(ctx, request)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if toolClient, ok := client.(ToolClient); ok {
+		return toolClient.InferWithTools(ctx, request, steps, tools, callback)
+	}
+
+	if len(steps) > 0 {
+		return "", nil, fmt.Errorf("provider for model %q does not support tools", request.Model)
+	}
+
+	response, err := inferStreamOrFallback(ctx, client, request, callback)
+	return response, nil, err
+}
+
+// InferJSON constrains the response if the resolved provider supports it
+func (r *Registry) InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error) {
+	client, request, err := r.resolve(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	structuredClient, ok := client.(StructuredClient)
+	if !ok {
+		return "", ErrStructuredUnsupported
+	}
+
+	return structuredClient.InferJSON(ctx, request, schema)
+}
+
+// StartProbes starts the health probes of the registered clients that have them
+func (r *Registry) StartProbes(ctx context.Context) {
+	for _, provider := range r.providers {
+		if prober, ok := provider.client.(interface{ StartProbes(context.Context) }); ok {
+			prober.StartProbes(ctx)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestRegistryResolve(t *testing.T) {
+	local := &OpenAIClient{}
+	cloud := &OpenAIClient{}
+
+	registry := NewRegistry("local")
+	registry.AddProvider("local", local, "llama3")
+	registry.AddProvider("cloud", cloud, "gpt-4o-mini")
+
+	if err := registry.AddAlias("smart", "cloud", "gpt-4o"); err != nil {
+		t.Fatalf("AddAlias: %v", err)
+	}
+	if err := registry.AddAlias("fast", "local", ""); err != nil {
+		t.Fatalf("AddAlias: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		wantProvider string
+		wantClient   Client
+		wantModel    string
+	}{
+		{"smart", "cloud", cloud, "gpt-4o"},
+		{"fast", "local", local, "llama3"},
+		{"cloud", "cloud", cloud, "gpt-4o-mini"},
+		{"local", "local", local, "llama3"},
+		{"mistral", "local", local, "mistral"},
+		{"", "local", local, "llama3"},
+	}
+
+	for _, test := range tests {
+		provider, client, model := registry.Resolve(test.name)
+		if provider != test.wantProvider || client != test.wantClient || model != test.wantModel {
+			t.Errorf("Resolve(%q) = %q, %p, %q, want %q, %p, %q", test.name, provider, client, model, test.wantProvider, test.wantClient, test.wantModel)
+		}
+	}
+}
+
+func TestRegistryAliasUnknownProvider(t *testing.T) {
+	registry := NewRegistry("local")
+	registry.AddProvider("local", &OpenAIClient{}, "llama3")
+
+	if err := registry.AddAlias("smart", "cloud", "gpt-4o"); err == nil {
+		t.Error("AddAlias accepted an unknown provider")
+	}
+
+	if _, _, model := registry.Resolve("smart"); model != "smart" {
+		t.Errorf("rejected alias still resolves to %q", model)
+	}
+}
+
+func TestRegistryInfer(t *testing.T) {
+	local := llmtest.NewServer(t)
+	cloud := llmtest.NewServer(t, llmtest.Completion("From the cloud"))
+
+	registry := NewRegistry("local")
+	registry.AddProvider("local", newTestClient(local), "llama3")
+	registry.AddProvider("cloud", newTestClient(cloud), "gpt-4o-mini")
+	if err := registry.AddAlias("smart", "cloud", "gpt-4o"); err != nil {
+		t.Fatalf("AddAlias: %v", err)
+	}
+
+	request := testRequest()
+	request.Model = "smart"
+
+	ctx, info := WithResponseInfo(context.Background())
+	response, err := registry.Infer(ctx, request)
+	if err != nil {
+		t.Fatalf("Infer: %v", err)
+	}
+
+	if response != "From the cloud" {
+		t.Errorf("response = %q", response)
+	}
+
+	if model := cloud.LastRequest().Body["model"]; model != "gpt-4o" {
+		t.Errorf("model sent = %v, want the alias model", model)
+	}
+
+	if len(local.Requests()) != 0 {
+		t.Errorf("default provider was called: %v", local.Requests())
+	}
+
+	if info.ServedBy != "cloud/gpt-4o" || info.Model != "gpt-4o" {
+		t.Errorf("response info = %+v", info)
+	}
+}
+
+func TestRegistryNoProvider(t *testing.T) {
+	registry := NewRegistry("missing")
+
+	if _, err := registry.Infer(context.Background(), testRequest()); err == nil {
+		t.Error("Infer succeeded without a provider")
+	}
+}
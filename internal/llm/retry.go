@@ -0,0 +1,176 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRateLimited   = errors.New("rate limited")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrContextLength = errors.New("context length exceeded")
+	ErrServer        = errors.New("server error")
+)
+
+// APIError is a non-200 response from an inference endpoint. It unwraps to one of the Err* sentinels above
+// when the failure could be classified, so callers can use errors.Is.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("inference request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Retryable reports whether repeating the same request may succeed
+func (e *APIError) Retryable() bool {
+	return e.kind == ErrRateLimited || e.kind == ErrServer
+}
+
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context length",
+	"too many tokens",
+	"prompt is too long",
+}
+
+// newAPIError classifies a failed response by status code and, for context length failures, by the body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	lowerBody := strings.ToLower(apiErr.Body)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.kind = ErrRateLimited
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.kind = ErrUnauthorized
+	case resp.StatusCode >= 500:
+		apiErr.kind = ErrServer
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge:
+		for _, marker := range contextLengthMarkers {
+			if strings.Contains(lowerBody, marker) {
+				apiErr.kind = ErrContextLength
+				break
+			}
+		}
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
+
+// RetryPolicy controls how failed requests are repeated. Attempts includes the first try.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  30 * time.Second,
+}
+
+// backoff returns the jittered exponential delay before the given retry (1-based)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Keep between half and the full delay so parallel requests don't retry in lockstep
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// do sends the request until it gets a 200 or the policy gives up. The request is rebuilt from the body on every
+// attempt. Only the response status is checked, so streaming callers never retry after the first token.
+func (p RetryPolicy) do(ctx context.Context, client *http.Client, body []byte, newRequest func(body io.Reader) (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		var retryAfter time.Duration
+		resp, err := client.Do(req)
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				return resp, nil
+			}
+
+			respBody, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			apiErr := newAPIError(resp, respBody)
+			if !apiErr.Retryable() {
+				return nil, apiErr
+			}
+
+			err = apiErr
+			retryAfter = apiErr.RetryAfter
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt >= p.Attempts {
+			return nil, err
+		}
+
+		delay := p.backoff(attempt)
+		if retryAfter > p.MaxDelay {
+			zap.L().Warn("retry-after exceeds the maximum delay, giving up", zap.Duration("retryAfter", retryAfter))
+			return nil, err
+		}
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+
+		zap.L().Warn("inference request failed, retrying", zap.Error(err), zap.Int("attempt", attempt), zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Synthesizer turns text into speech
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string, voice string) ([]byte, error)
+}
+
+// OpenAISynthesizer uses an OpenAI-compatible /audio/speech endpoint
+type OpenAISynthesizer struct {
+	Endpoint string
+	Token    string
+	Model    string
+	Format   string // mp3, opus, aac, flac, wav or pcm
+	Retry    RetryPolicy
+}
+
+func NewOpenAISynthesizer(endpoint string, token string, model string, format string, retry RetryPolicy) *OpenAISynthesizer {
+	return &OpenAISynthesizer{
+		Endpoint: endpoint,
+		Token:    token,
+		Model:    model,
+		Format:   format,
+		Retry:    retry,
+	}
+}
+
+func (s *OpenAISynthesizer) Synthesize(ctx context.Context, text string, voice string) ([]byte, error) {
+	jsonBody, err := json.Marshal(map[string]any{
+		"model":           s.Model,
+		"input":           text,
+		"voice":           voice,
+		"response_format": s.Format,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", s.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.Token)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	client := &http.Client{Timeout: 180 * time.Second}
+	resp, err := s.Retry.do(ctx, client, jsonBody, newRequest)
+	if err != nil {
+		zap.L().Error("speech request failed", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,40 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestSynthesize(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Response{Body: "ID3audio", Header: map[string]string{"Content-Type": "audio/mpeg"}})
+	synthesizer := NewOpenAISynthesizer(server.URL+"/v1/audio/speech", "test-token", "tts-1", "mp3", testRetry)
+
+	audio, err := synthesizer.Synthesize(context.Background(), "Hello there.", "onyx")
+	if err != nil {
+		t.Fatalf("Synthesize: %v", err)
+	}
+
+	if string(audio) != "ID3audio" {
+		t.Errorf("audio = %q", audio)
+	}
+
+	request := server.LastRequest()
+	if request.Header.Get("Authorization") != "Bearer test-token" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+	if request.Body["model"] != "tts-1" || request.Body["input"] != "Hello there." || request.Body["voice"] != "onyx" || request.Body["response_format"] != "mp3" {
+		t.Errorf("unexpected request %v", request.Body)
+	}
+}
+
+func TestSynthesizeError(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Error(http.StatusUnauthorized, `{"error":{"message":"bad key"}}`))
+	synthesizer := NewOpenAISynthesizer(server.URL+"/v1/audio/speech", "", "tts-1", "mp3", testRetry)
+
+	if _, err := synthesizer.Synthesize(context.Background(), "Hello there.", "onyx"); err == nil {
+		t.Error("Synthesize succeeded on a 401")
+	}
+}
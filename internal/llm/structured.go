@@ -0,0 +1,314 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// structuredAttempts is how many times the model is asked again after returning invalid JSON, including the first try
+const structuredAttempts = 3
+
+// ErrStructuredUnsupported is returned by StructuredClient implementations that wrap other clients when none of
+// them can constrain the response, so the caller falls back to asking for JSON in the prompt
+var ErrStructuredUnsupported = errors.New("structured output not supported")
+
+// JSONSchema describes the JSON a structured call has to return
+type JSONSchema struct {
+	Name   string
+	Schema map[string]any
+	Strict bool // every property is required, which strict schema modes of providers demand
+}
+
+// StructuredClient is implemented by clients whose provider can constrain the response to a JSON schema
+type StructuredClient interface {
+	InferJSON(ctx context.Context, request Request, schema JSONSchema) (string, error)
+}
+
+// Validator can be implemented by structured output targets to check what the schema can't express
+type Validator interface {
+	Validate() error
+}
+
+// InferStructured asks the model for JSON matching the struct target points to and decodes the response into it.
+// The schema is derived from the struct's json tags, plus optional description and enum (comma separated) tags.
+// Providers that support it get the schema as a response format, the others are told about it in the system prompt.
+// Invalid responses are repaired where possible and otherwise sent back to the model with the error.
+func InferStructured(ctx context.Context, client Client, request Request, target any) error {
+	targetType := reflect.TypeOf(target)
+	if targetType == nil || targetType.Kind() != reflect.Pointer {
+		return errors.New("structured output target must be a pointer")
+	}
+
+	schema := SchemaFor(targetType.Elem())
+	schemaJSON, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return err
+	}
+
+	structuredClient, constrained := client.(StructuredClient)
+	promptRequest := request
+	promptRequest.System = request.System + "\n\nRespond only with JSON matching this JSON schema, without any other text or formatting:\n" + string(schemaJSON)
+
+	var lastErr error
+	for attempt := 1; attempt <= structuredAttempts; attempt++ {
+		var raw string
+		if constrained {
+			raw, err = structuredClient.InferJSON(ctx, request, schema)
+			if rejectsResponseFormat(err) {
+				zap.L().Warn("response format rejected, asking for JSON in the prompt", zap.Error(err))
+			}
+			if errors.Is(err, ErrStructuredUnsupported) || rejectsResponseFormat(err) {
+				constrained = false
+			}
+		}
+
+		if !constrained {
+			promptRequest.Message, promptRequest.History = request.Message, request.History
+			raw, err = client.Infer(ctx, promptRequest)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		lastErr = decodeStructured(raw, schema, target)
+		if lastErr == nil {
+			return nil
+		}
+
+		zap.L().Warn("invalid structured output", zap.Int("attempt", attempt), zap.Error(lastErr), zap.String("response", raw))
+
+		// Show the model what it said and what was wrong with it
+		request.History = append(slices.Clip(request.History), HistoryItem{Content: request.Message}, HistoryItem{IsBotMessage: true, Content: raw})
+		request.Message = fmt.Sprintf("Your response was invalid: %v. Respond again with only the corrected JSON.", lastErr)
+	}
+
+	return fmt.Errorf("no valid structured output after %d attempts: %w", structuredAttempts, lastErr)
+}
+
+// rejectsResponseFormat reports whether an OpenAI-compatible server refused the request, most likely because it
+// doesn't support response_format
+func rejectsResponseFormat(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest && !errors.Is(err, ErrContextLength)
+}
+
+// decodeStructured repairs the response, validates it against the schema and decodes it into target
+func decodeStructured(raw string, schema JSONSchema, target any) error {
+	text := repairJSON(raw)
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+
+	if err := validateJSON(value, schema.Schema, "$"); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(text), target); err != nil {
+		return err
+	}
+
+	if validator, ok := target.(Validator); ok {
+		return validator.Validate()
+	}
+
+	return nil
+}
+
+var trailingCommaRegex = regexp.MustCompile(`,\s*([}\]])`)
+
+// repairJSON fixes the usual ways models wrap or break JSON: reasoning, markdown fences, text around the value
+// and trailing commas
+func repairJSON(text string) string {
+	text, _ = splitThink(text)
+	text = strings.TrimSpace(text)
+	if json.Valid([]byte(text)) {
+		return text
+	}
+
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start >= 0 && end > start {
+		text = text[start : end+1]
+	}
+
+	if json.Valid([]byte(text)) {
+		return text
+	}
+
+	return trailingCommaRegex.ReplaceAllString(text, "$1")
+}
+
+// SchemaFor derives a JSON schema from a Go type
+func SchemaFor(t reflect.Type) JSONSchema {
+	strict := true
+	schema := typeSchema(t, &strict)
+
+	name := t.Name()
+	if name == "" {
+		name = "response"
+	}
+
+	return JSONSchema{Name: name, Schema: schema, Strict: strict}
+}
+
+func typeSchema(t reflect.Type, strict *bool) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		// Pointers are optional, which in strict mode means nullable
+		schema := typeSchema(t.Elem(), strict)
+		if schemaType, ok := schema["type"].(string); ok {
+			schema["type"] = []string{schemaType, "null"}
+		}
+
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), strict)}
+	case reflect.Map:
+		*strict = false
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), strict)}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property := typeSchema(field.Type, strict)
+			if description := field.Tag.Get("description"); description != "" {
+				property["description"] = description
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+
+			properties[name] = property
+			if strings.Contains(options, "omitempty") {
+				*strict = false
+			} else {
+				required = append(required, name)
+			}
+		}
+
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		*strict = false
+		return map[string]any{}
+	}
+}
+
+// validateJSON checks a decoded JSON value against the subset of JSON schema produced by SchemaFor
+func validateJSON(value any, schema map[string]any, path string) error {
+	schemaType := schema["type"]
+	if types, ok := schemaType.([]string); ok {
+		if value == nil && slices.Contains(types, "null") {
+			return nil
+		}
+
+		schemaType = types[0]
+	}
+
+	if enum, ok := schema["enum"].([]string); ok {
+		text, isString := value.(string)
+		if !isString || !slices.Contains(enum, text) {
+			return fmt.Errorf("%s must be one of %s", path, strings.Join(enum, ", "))
+		}
+	}
+
+	switch schemaType {
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+
+		itemSchema, _ := schema["items"].(map[string]any)
+		for i, item := range items {
+			if err := validateJSON(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is missing", path, name)
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		additional, _ := schema["additionalProperties"].(map[string]any)
+		for name, property := range object {
+			propertySchema, known := properties[name].(map[string]any)
+			if !known {
+				if additional == nil && properties != nil {
+					return fmt.Errorf("%s.%s is not an allowed property", path, name)
+				}
+				propertySchema = additional
+			}
+
+			if err := validateJSON(property, propertySchema, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+type testAssessment struct {
+	Threat   string   `json:"threat" enum:"low,medium,high" description:"Threat level"`
+	Units    int      `json:"units"`
+	Sources  []string `json:"sources"`
+	Note     *string  `json:"note"`
+	Optional string   `json:"optional,omitempty"`
+
+	internal string
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"valid", `{"a":1}`, `{"a":1}`},
+		{"whitespace", "  {\"a\":1}\n", `{"a":1}`},
+		{"code fence", "```json\n{\"a\":1}\n```", `{"a":1}`},
+		{"surrounding text", `Sure! Here it is: {"a":[1,2]} Hope that helps.`, `{"a":[1,2]}`},
+		{"trailing commas", `{"a":[1,2,],"b":3,}`, `{"a":[1,2],"b":3}`},
+		{"reasoning", `<think>{"wrong":true}</think>{"a":1}`, `{"a":1}`},
+		{"array", "Result:\n[1, 2]", `[1, 2]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repairJSON(tt.text); got != tt.want {
+				t.Errorf("repairJSON(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor(reflect.TypeOf(testAssessment{}))
+	if schema.Name != "testAssessment" || schema.Strict {
+		t.Errorf("name %q, strict %v; want testAssessment and not strict because of omitempty", schema.Name, schema.Strict)
+	}
+
+	properties := schema.Schema["properties"].(map[string]any)
+	if _, ok := properties["internal"]; ok || len(properties) != 5 {
+		t.Errorf("properties = %v, want the five exported fields", properties)
+	}
+
+	threat := properties["threat"].(map[string]any)
+	if !slices.Equal(threat["enum"].([]string), []string{"low", "medium", "high"}) || threat["description"] != "Threat level" {
+		t.Errorf("threat = %v", threat)
+	}
+
+	if note := properties["note"].(map[string]any); !slices.Equal(note["type"].([]string), []string{"string", "null"}) {
+		t.Errorf("note = %v, want a nullable string", note)
+	}
+
+	if sources := properties["sources"].(map[string]any); sources["type"] != "array" {
+		t.Errorf("sources = %v, want an array", sources)
+	}
+
+	required := schema.Schema["required"].([]string)
+	if slices.Contains(required, "optional") || !slices.Contains(required, "units") {
+		t.Errorf("required = %v", required)
+	}
+
+	if strict := SchemaFor(reflect.TypeOf(struct {
+		A string `json:"a"`
+	}{})); !strict.Strict || strict.Name != "response" {
+		t.Errorf("anonymous struct without optional fields: %+v", strict)
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := SchemaFor(reflect.TypeOf(testAssessment{})).Schema
+
+	tests := []struct {
+		name    string
+		value   map[string]any
+		wantErr string
+	}{
+		{"valid", map[string]any{"threat": "low", "units": 3.0, "sources": []any{"a"}, "note": nil}, ""},
+		{"optional set", map[string]any{"threat": "high", "units": 0.0, "sources": []any{}, "note": "x", "optional": "y"}, ""},
+		{"missing field", map[string]any{"threat": "low", "units": 3.0, "note": nil}, "$.sources is missing"},
+		{"enum", map[string]any{"threat": "extreme", "units": 3.0, "sources": []any{}, "note": nil}, "$.threat must be one of low, medium, high"},
+		{"integer", map[string]any{"threat": "low", "units": 2.5, "sources": []any{}, "note": nil}, "$.units must be an integer"},
+		{"array item", map[string]any{"threat": "low", "units": 1.0, "sources": []any{1.0}, "note": nil}, "$.sources[0] must be a string"},
+		{"unknown property", map[string]any{"threat": "low", "units": 1.0, "sources": []any{}, "note": nil, "extra": true}, "$.extra is not an allowed property"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJSON(tt.value, schema, "$")
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInferStructuredResponseFormatRejected(t *testing.T) {
+	server := llmtest.NewServer(t,
+		llmtest.Error(400, `{"error":{"message":"Unknown parameter: response_format"}}`),
+		llmtest.Completion(`{"threat":"low","units":1,"sources":[],"note":null}`),
+	)
+
+	var assessment testAssessment
+	if err := InferStructured(context.Background(), newTestClient(server), testRequest(), &assessment); err != nil {
+		t.Fatalf("InferStructured: %v", err)
+	}
+
+	if assessment.Threat != "low" || assessment.Units != 1 {
+		t.Errorf("assessment = %+v", assessment)
+	}
+
+	request := server.LastRequest()
+	if _, ok := request.Body["response_format"]; ok {
+		t.Errorf("retry still sent response_format: %s", request)
+	}
+	if system := request.Messages()[0]["content"].(string); !strings.Contains(system, "JSON schema") {
+		t.Errorf("retry didn't put the schema in the prompt: %q", system)
+	}
+}
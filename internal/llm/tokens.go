@@ -0,0 +1,65 @@
+package llm
+
+import "unicode/utf8"
+
+// DefaultCharsPerToken is a rough average for English text with BPE tokenizers
+const DefaultCharsPerToken = 4.0
+
+// TokenEstimator approximates token counts from character counts. CharsPerToken can be calibrated per model by
+// comparing the estimate with the prompt token usage reported by the provider.
+type TokenEstimator struct {
+	CharsPerToken float64
+}
+
+var defaultEstimator = TokenEstimator{CharsPerToken: DefaultCharsPerToken}
+
+func (e TokenEstimator) charsPerToken() float64 {
+	if e.CharsPerToken <= 0 {
+		return DefaultCharsPerToken
+	}
+
+	return e.CharsPerToken
+}
+
+// Count returns an approximate token count for the text
+func (e TokenEstimator) Count(text string) int {
+	runes := utf8.RuneCountInString(text)
+	if runes == 0 {
+		return 0
+	}
+
+	return int(float64(runes)/e.charsPerToken()) + 1
+}
+
+// Truncate cuts the text to approximately maxTokens tokens without splitting a UTF-8 character.
+// The second return value reports whether anything was cut.
+func (e TokenEstimator) Truncate(text string, maxTokens int) (string, bool) {
+	if maxTokens <= 0 {
+		return "", text != ""
+	}
+
+	maxChars := int(float64(maxTokens) * e.charsPerToken())
+	if utf8.RuneCountInString(text) <= maxChars {
+		return text, false
+	}
+
+	runes := 0
+	for i := range text {
+		if runes == maxChars {
+			return text[:i], true
+		}
+		runes++
+	}
+
+	return text, false
+}
+
+// EstimateTokens returns an approximate token count for the text using the default ratio
+func EstimateTokens(text string) int {
+	return defaultEstimator.Count(text)
+}
+
+// TruncateToTokens cuts the text to approximately maxTokens tokens using the default ratio
+func TruncateToTokens(text string, maxTokens int) (string, bool) {
+	return defaultEstimator.Truncate(text, maxTokens)
+}
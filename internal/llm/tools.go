@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// Tool is an action the model can ask the bot to perform
+type Tool interface {
+	Name() string
+	Description() string
+
+	// Parameters returns the JSON schema of the arguments object
+	Parameters() map[string]any
+
+	// Execute runs the tool with the JSON encoded arguments produced by the model and returns the result as text
+	Execute(ctx context.Context, arguments string) (string, error)
+}
+
+// ToolCall is a single tool invocation requested by the model
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON encoded
+}
+
+// ToolClient is an optional interface for clients that support tool calling
+type ToolClient interface {
+	// InferWithTools runs a single step of a tool-using conversation. Steps are the tool calls and results of the
+	// previous steps and are placed after the message. Content is streamed through the callback; if the model asks
+	// for tools, they are returned and the caller is expected to execute them and call again with extended steps.
+	InferWithTools(ctx context.Context, request Request, steps []HistoryItem, tools []Tool, callback func(content string, done bool)) (string, []ToolCall, error)
+}
+
+// ExecuteToolCall finds the requested tool and runs it. Failures are returned as the result text so the model can
+// see what went wrong and recover.
+func ExecuteToolCall(ctx context.Context, tools []Tool, call ToolCall) (string, error) {
+	for _, tool := range tools {
+		if tool.Name() != call.Name {
+			continue
+		}
+
+		result, err := tool.Execute(ctx, call.Arguments)
+		if err != nil {
+			return fmt.Sprintf("error: %s", err), err
+		}
+
+		return result, nil
+	}
+
+	err := fmt.Errorf("unknown tool: %s", call.Name)
+	return fmt.Sprintf("error: %s", err), err
+}
+
+// RunTools runs a tool-using conversation until the model answers without asking for tools, executing the tools
+// between steps. Steps aren't streamed, since text the model writes before calling tools is not the answer; only the
+// final answer is returned. After maxSteps steps the model has to answer with what it has. beforeTools, if set, is
+// called before the tools of a step run.
+func RunTools(ctx context.Context, client ToolClient, request Request, tools []Tool, maxSteps int, beforeTools func(calls []ToolCall)) (string, error) {
+	var steps []HistoryItem
+	for step := 0; ; step++ {
+		stepTools := tools
+		if step >= maxSteps {
+			zap.L().Warn("tool step limit reached", zap.Int("steps", step))
+			stepTools = nil
+		}
+
+		response, toolCalls, err := client.InferWithTools(ctx, request, steps, stepTools, nil)
+		if err != nil || len(toolCalls) == 0 || stepTools == nil {
+			return response, err
+		}
+
+		if beforeTools != nil {
+			beforeTools(toolCalls)
+		}
+
+		steps = append(steps, HistoryItem{IsBotMessage: true, Content: response, ToolCalls: toolCalls})
+		for _, call := range toolCalls {
+			result, callErr := ExecuteToolCall(ctx, tools, call)
+			zap.L().Info("tool call",
+				zap.Int("step", step),
+				zap.String("tool", call.Name),
+				zap.String("arguments", call.Arguments),
+				zap.Int("resultLength", len(result)),
+				zap.Error(callErr),
+			)
+
+			steps = append(steps, HistoryItem{ToolCallID: call.ID, Content: result})
+		}
+	}
+}
+
+// toolCallAccumulator assembles tool calls from streamed deltas, where the arguments arrive in fragments
+type toolCallAccumulator struct {
+	calls map[int]*ToolCall
+}
+
+func (a *toolCallAccumulator) add(index int, id string, name string, arguments string) {
+	if a.calls == nil {
+		a.calls = make(map[int]*ToolCall)
+	}
+
+	call, ok := a.calls[index]
+	if !ok {
+		call = &ToolCall{}
+		a.calls[index] = call
+	}
+
+	if id != "" {
+		call.ID = id
+	}
+	if name != "" {
+		call.Name = name
+	}
+	call.Arguments += arguments
+}
+
+func (a *toolCallAccumulator) result() []ToolCall {
+	if len(a.calls) == 0 {
+		return nil
+	}
+
+	indexes := make([]int, 0, len(a.calls))
+	for index := range a.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	calls := make([]ToolCall, 0, len(indexes))
+	for _, index := range indexes {
+		calls = append(calls, *a.calls[index])
+	}
+
+	return calls
+}
@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+// countingTool answers with a fixed result and counts its calls
+type countingTool struct {
+	name   string
+	result string
+	err    error
+	calls  int
+}
+
+func (t *countingTool) Name() string               { return t.name }
+func (t *countingTool) Description() string        { return "Test tool" }
+func (t *countingTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *countingTool) Execute(ctx context.Context, arguments string) (string, error) {
+	t.calls++
+	return t.result, t.err
+}
+
+func TestExecuteToolCall(t *testing.T) {
+	tools := []Tool{
+		&countingTool{name: "lookup", result: "found"},
+		&countingTool{name: "broken", err: errors.New("unreachable")},
+	}
+
+	tests := []struct {
+		name    string
+		call    ToolCall
+		want    string
+		wantErr bool
+	}{
+		{name: "dispatched by name", call: ToolCall{Name: "lookup"}, want: "found"},
+		{name: "tool error", call: ToolCall{Name: "broken"}, want: "error: unreachable", wantErr: true},
+		{name: "unknown tool", call: ToolCall{Name: "missing"}, want: "error: unknown tool: missing", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExecuteToolCall(context.Background(), tools, tt.call)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ExecuteToolCall = %q, %v; want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunTools(t *testing.T) {
+	server := llmtest.NewServer(t,
+		llmtest.Response{Chunks: []string{
+			llmtest.Delta("Let me look that up."),
+			llmtest.ToolCallDelta(0, "call_1", "lookup", `{"query":"tanks"}`),
+			llmtest.Done(),
+		}},
+		llmtest.Stream("There are ", "42 tanks."),
+	)
+	tool := &countingTool{name: "lookup", result: "42"}
+
+	var toolSteps int
+	response, err := RunTools(context.Background(), newTestClient(server), testRequest(), []Tool{tool}, 4, func(calls []ToolCall) {
+		toolSteps++
+	})
+	if err != nil {
+		t.Fatalf("RunTools: %v", err)
+	}
+
+	if response != "There are 42 tanks." {
+		t.Errorf("response = %q, want only the final answer", response)
+	}
+	if tool.calls != 1 || toolSteps != 1 {
+		t.Errorf("tool ran %d times in %d steps, want once", tool.calls, toolSteps)
+	}
+
+	messages := server.LastRequest().Messages()
+	last := messages[len(messages)-1]
+	if last["role"] != "tool" || last["tool_call_id"] != "call_1" || last["content"] != "42" {
+		t.Errorf("tool result not sent back: %v", last)
+	}
+}
+
+func TestRunToolsStepLimit(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.Stream("Answer without tools."))
+	tool := &countingTool{name: "lookup"}
+
+	response, err := RunTools(context.Background(), newTestClient(server), testRequest(), []Tool{tool}, 0, nil)
+	if err != nil {
+		t.Fatalf("RunTools: %v", err)
+	}
+
+	if response != "Answer without tools." || tool.calls != 0 {
+		t.Errorf("response = %q after %d tool calls", response, tool.calls)
+	}
+	if _, ok := server.LastRequest().Body["tools"]; ok {
+		t.Error("tools offered after the step limit")
+	}
+}
@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var audioExtensions = map[string]bool{
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".mp3":  true,
+	".wav":  true,
+	".m4a":  true,
+	".webm": true,
+	".flac": true,
+}
+
+// IsAudioAttachment reports whether a Discord attachment looks like speech that can be transcribed,
+// such as a voice message
+func IsAudioAttachment(attachment *discordgo.MessageAttachment) bool {
+	if attachment == nil {
+		return false
+	}
+
+	if strings.HasPrefix(attachment.ContentType, "audio/") {
+		return true
+	}
+
+	return audioExtensions[strings.ToLower(path.Ext(attachment.Filename))]
+}
+
+// Transcriber turns speech into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, filename string, audio []byte) (string, error)
+}
+
+// OpenAITranscriber uses an OpenAI-compatible /audio/transcriptions endpoint, such as whisper.cpp's server
+type OpenAITranscriber struct {
+	Endpoint string
+	Token    string
+	Model    string
+	Language string
+	Retry    RetryPolicy
+}
+
+func NewOpenAITranscriber(endpoint string, token string, model string, language string, retry RetryPolicy) *OpenAITranscriber {
+	return &OpenAITranscriber{
+		Endpoint: endpoint,
+		Token:    token,
+		Model:    model,
+		Language: language,
+		Retry:    retry,
+	}
+}
+
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, filename string, audio []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	file, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Write(audio); err != nil {
+		return "", err
+	}
+
+	fields := map[string]string{
+		"model":           t.Model,
+		"language":        t.Language,
+		"response_format": "json",
+	}
+
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+
+		if err := form.WriteField(name, value); err != nil {
+			return "", err
+		}
+	}
+
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	newRequest := func(body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", t.Endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+t.Token)
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		return req, nil
+	}
+
+	client := &http.Client{Timeout: 300 * time.Second}
+	resp, err := t.Retry.do(ctx, client, body.Bytes(), newRequest)
+	if err != nil {
+		zap.L().Error("transcription request failed", zap.Error(err))
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"discord-military-analyst-bot/internal/llm/llmtest"
+)
+
+func TestTranscribe(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{"text": "  Hold the line.\n"}))
+	transcriber := NewOpenAITranscriber(server.URL+"/v1/audio/transcriptions", "test-token", "whisper-1", "en", testRetry)
+
+	text, err := transcriber.Transcribe(context.Background(), "voice-message.ogg", []byte("OggS audio"))
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+
+	if text != "Hold the line." {
+		t.Errorf("text = %q", text)
+	}
+
+	request := server.LastRequest()
+	if request.Header.Get("Authorization") != "Bearer test-token" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("unexpected content type %q", request.Header.Get("Content-Type"))
+	}
+
+	form, err := multipart.NewReader(bytes.NewReader(request.Raw), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("ReadForm: %v", err)
+	}
+
+	for name, want := range map[string]string{"model": "whisper-1", "language": "en", "response_format": "json"} {
+		if got := form.Value[name]; len(got) != 1 || got[0] != want {
+			t.Errorf("field %s = %q, want %q", name, got, want)
+		}
+	}
+
+	files := form.File["file"]
+	if len(files) != 1 || files[0].Filename != "voice-message.ogg" {
+		t.Fatalf("unexpected file parts %v", files)
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+
+	audio, _ := io.ReadAll(file)
+	if string(audio) != "OggS audio" {
+		t.Errorf("audio = %q", audio)
+	}
+}
+
+func TestTranscribeOmitsEmptyFields(t *testing.T) {
+	server := llmtest.NewServer(t, llmtest.JSON(map[string]any{"text": "ok"}))
+	transcriber := NewOpenAITranscriber(server.URL+"/v1/audio/transcriptions", "", "whisper-1", "", testRetry)
+
+	if _, err := transcriber.Transcribe(context.Background(), "a.mp3", []byte("audio")); err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+
+	request := server.LastRequest()
+	if request.Header.Get("Authorization") != "" {
+		t.Errorf("Authorization sent without a token")
+	}
+
+	_, params, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	form, err := multipart.NewReader(bytes.NewReader(request.Raw), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("ReadForm: %v", err)
+	}
+
+	if _, ok := form.Value["language"]; ok {
+		t.Errorf("empty language sent: %v", form.Value)
+	}
+}
+
+func TestIsAudioAttachment(t *testing.T) {
+	tests := []struct {
+		attachment *discordgo.MessageAttachment
+		want       bool
+	}{
+		{nil, false},
+		{&discordgo.MessageAttachment{Filename: "voice-message.ogg", ContentType: "audio/ogg"}, true},
+		{&discordgo.MessageAttachment{Filename: "clip.MP3"}, true},
+		{&discordgo.MessageAttachment{Filename: "map.png", ContentType: "image/png"}, false},
+	}
+
+	for _, test := range tests {
+		if got := IsAudioAttachment(test.attachment); got != test.want {
+			t.Errorf("IsAudioAttachment(%+v) = %v, want %v", test.attachment, got, test.want)
+		}
+	}
+}
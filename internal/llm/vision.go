@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"discord-military-analyst-bot/internal/config"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+var imageExtensions = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// IsImageAttachment reports whether a Discord attachment looks like an image a vision model can read
+func IsImageAttachment(attachment *discordgo.MessageAttachment) bool {
+	if attachment == nil {
+		return false
+	}
+
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		return true
+	}
+
+	_, ok := imageExtensions[strings.ToLower(path.Ext(attachment.Filename))]
+	return ok
+}
+
+// selectImages picks the image attachments of user messages to send for each history item, newest first, within
+// the count and size limits of the vision settings. The result is indexed like history.
+func selectImages(vision config.VisionConfig, history []HistoryItem) [][]*discordgo.MessageAttachment {
+	selected := make([][]*discordgo.MessageAttachment, len(history))
+	if !vision.Enabled {
+		return selected
+	}
+
+	budget := vision.MaxImages
+	for i := len(history) - 1; i >= 0 && budget > 0; i-- {
+		// Only user messages may carry images
+		if history[i].IsBotMessage {
+			continue
+		}
+
+		for _, attachment := range history[i].Attachments {
+			if budget <= 0 {
+				break
+			}
+
+			if !IsImageAttachment(attachment) {
+				continue
+			}
+
+			if attachment.Size > vision.MaxImageBytes {
+				zap.L().Debug("skipping oversized image", zap.String("filename", attachment.Filename), zap.Int("size", attachment.Size))
+				continue
+			}
+
+			selected[i] = append(selected[i], attachment)
+			budget--
+		}
+	}
+
+	return selected
+}
+
+// imageURL returns the URL the model should load the image from, downloading and inlining it as a data URL
+// if the inference server cannot reach Discord's CDN
+func imageURL(ctx context.Context, vision config.VisionConfig, attachment *discordgo.MessageAttachment) (string, error) {
+	if !vision.InlineImages {
+		return attachment.URL, nil
+	}
+
+	data, downloadedType, err := DownloadAttachment(ctx, attachment, vision.MaxImageBytes)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := attachment.ContentType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = downloadedType
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = imageExtensions[strings.ToLower(path.Ext(attachment.Filename))]
+	}
+
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DownloadAttachment downloads a Discord attachment of at most maxBytes, returning it with the content type
+// reported by the CDN
+func DownloadAttachment(ctx context.Context, attachment *discordgo.MessageAttachment, maxBytes int) ([]byte, string, error) {
+	if attachment.Size > maxBytes {
+		return nil, "", errors.New("attachment exceeds size limit")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", attachment.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status downloading attachment: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(data) > maxBytes {
+		return nil, "", errors.New("attachment exceeds size limit")
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// imageParts converts attachments into OpenAI image_url content parts, skipping the ones that cannot be loaded
+func imageParts(ctx context.Context, vision config.VisionConfig, attachments []*discordgo.MessageAttachment) []map[string]any {
+	parts := make([]map[string]any, 0, len(attachments))
+	for _, attachment := range attachments {
+		url, err := imageURL(ctx, vision, attachment)
+		if err != nil {
+			zap.L().Warn("failed to load image attachment", zap.String("filename", attachment.Filename), zap.Error(err))
+			continue
+		}
+
+		parts = append(parts, map[string]any{
+			"type":      "image_url",
+			"image_url": map[string]any{"url": url},
+		})
+	}
+
+	return parts
+}